@@ -0,0 +1,85 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"strings"
+	"time"
+
+	"github.com/fluent/fluent-logger-golang/fluent"
+	"github.com/ztrue/tracerr"
+)
+
+//*****************************************************************************
+
+// the default wait for the acknowledgement of a batch
+const defaultAckTimeout = 5 * time.Second
+
+//-----------------------------------------------------------------------------
+
+// asyncResult receives the outcome of the writes of an async Fluentd client.
+// The messages it failed to deliver (e.g. not acknowledged) are decoded and
+// handed to the spool or the FallbackWriter
+func (l *Logger) asyncResult(prefix string, data []byte, err error) {
+	if err == nil || data == nil {
+		return
+	}
+
+	tag, t, record, derr := decodeMessage(data)
+	if derr != nil {
+		tracerr.PrintSource(err)
+		return
+	}
+	if prefix != "" {
+		tag = strings.TrimPrefix(tag, prefix+".")
+	}
+	if rerr := l.rescue(tag, t, record, err); rerr != nil {
+		tracerr.PrintSource(rerr)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// decodeMessage decodes a Message mode message encoded by a Fluentd client
+func decodeMessage(data []byte) (string, time.Time, interface{}, error) {
+	var m fluent.Message
+	if _, err := m.UnmarshalMsg(data); err == nil {
+		return m.Tag, time.Unix(m.Time, 0), m.Record, nil
+	}
+
+	var ext fluent.MessageExt
+	if _, err := ext.UnmarshalMsg(data); err != nil {
+		return "", time.Time{}, nil, err
+	}
+	return ext.Tag, time.Time(ext.Time), ext.Record, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// asyncResultCallback returns the AsyncResultCallback of a client, calling
+// the one of the configuration too. owner is set once the Logger is built
+func asyncResultCallback(config fluent.Config, owner **Logger) func([]byte, error) {
+	callback := config.AsyncResultCallback
+	return func(data []byte, err error) {
+		if callback != nil {
+			callback(data, err)
+		}
+		if *owner != nil {
+			(*owner).asyncResult(config.TagPrefix, data, err)
+		}
+	}
+}
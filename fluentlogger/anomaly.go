@@ -0,0 +1,87 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"sync"
+	"time"
+)
+
+//*****************************************************************************
+
+const (
+	defaultLatencyBaselineWindow = 100
+	defaultLatencyAnomalyFactor  = 3.0
+)
+
+//-----------------------------------------------------------------------------
+
+// latencyBaseline keeps an exponentially weighted moving average of the
+// latency of each route. The smoothing factor 2/(window+1) gives roughly the
+// weight of a simple average over the last window requests, in constant
+// memory per route
+type latencyBaseline struct {
+	mu         sync.Mutex
+	alpha      float64
+	factor     float64
+	minSamples int
+	routes     map[string]*routeLatency
+}
+
+type routeLatency struct {
+	average float64 // in nanoseconds
+	samples int
+}
+
+//-----------------------------------------------------------------------------
+
+// newLatencyBaseline creates a baseline, using the defaults for zero values
+func newLatencyBaseline(window int, factor float64) *latencyBaseline {
+	if window <= 0 {
+		window = defaultLatencyBaselineWindow
+	}
+	if factor <= 0 {
+		factor = defaultLatencyAnomalyFactor
+	}
+	return &latencyBaseline{
+		alpha:      2 / float64(window+1),
+		factor:     factor,
+		minSamples: max(window/10, 1),
+		routes:     make(map[string]*routeLatency),
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// observe tells whether latency is anomalous for route and then adds it to
+// the baseline. Nothing is flagged until the route has enough samples
+func (b *latencyBaseline) observe(route string, latency time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	value := float64(latency)
+	r, ok := b.routes[route]
+	if !ok {
+		b.routes[route] = &routeLatency{average: value, samples: 1}
+		return false
+	}
+
+	anomaly := r.samples >= b.minSamples && value > r.average*b.factor
+	r.average += b.alpha * (value - r.average)
+	r.samples++
+	return anomaly
+}
@@ -0,0 +1,158 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"context"
+	"time"
+
+	"github.com/ztrue/tracerr"
+)
+
+//*****************************************************************************
+
+// OverflowPolicy tells what to do with a record when the async queue is full
+type OverflowPolicy int
+
+const (
+	OverflowDropNewest OverflowPolicy = iota // discard the incoming record
+	OverflowDropOldest                       // discard the oldest queued record
+	OverflowBlock                            // wait for room in the queue
+)
+
+// how often Flush checks whether the queue has been drained
+const flushPollInterval = 10 * time.Millisecond
+
+//-----------------------------------------------------------------------------
+
+type queuedMessage struct {
+	tag     string
+	time    time.Time
+	message interface{}
+}
+
+//-----------------------------------------------------------------------------
+
+// Dropped returns the number of records discarded because the async queue
+// was full or too many timed out posts were running, see PostTimeout
+func (l *Logger) Dropped() uint64 {
+	return l.dropped.Load()
+}
+
+//-----------------------------------------------------------------------------
+
+// startWorkers creates the queue and the goroutines draining it
+func (l *Logger) startWorkers(size, workers int) {
+	if workers <= 0 {
+		workers = 1
+	}
+	l.queue = make(chan queuedMessage, size)
+	for i := 0; i < workers; i++ {
+		l.workers.Add(1)
+		go l.work()
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// work posts the queued messages until the queue is closed
+func (l *Logger) work() {
+	defer l.workers.Done()
+	for m := range l.queue {
+		if l.batches != nil {
+			l.batches.add(m)
+		} else if err := l.post(m.tag, m.time, m.message); err != nil {
+			tracerr.PrintSource(err)
+		}
+		l.inFlight.Add(-1)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// enqueue adds a message to the queue applying the overflow policy. It
+// tells whether the message was queued
+func (l *Logger) enqueue(m queuedMessage) bool {
+	l.queueMu.RLock()
+	defer l.queueMu.RUnlock()
+	if l.closed {
+		l.dropped.Add(1)
+		return false
+	}
+
+	l.inFlight.Add(1)
+	switch l.config().OverflowPolicy {
+	case OverflowBlock:
+		l.queue <- m
+		return true
+	case OverflowDropOldest:
+		for {
+			select {
+			case l.queue <- m:
+				return true
+			default:
+			}
+			select {
+			case <-l.queue:
+				l.inFlight.Add(-1)
+				l.dropped.Add(1)
+			default:
+			}
+		}
+	default:
+		select {
+		case l.queue <- m:
+			return true
+		default:
+			l.inFlight.Add(-1)
+			l.dropped.Add(1)
+			return false
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// drain waits until every queued message has been posted
+func (l *Logger) drain(ctx context.Context) error {
+	ticker := time.NewTicker(flushPollInterval)
+	defer ticker.Stop()
+	for l.inFlight.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// stopWorkers closes the queue and waits for the workers to post what is left
+func (l *Logger) stopWorkers() {
+	l.queueMu.Lock()
+	if l.closed {
+		l.queueMu.Unlock()
+		return
+	}
+	l.closed = true
+	close(l.queue)
+	l.queueMu.Unlock()
+
+	l.workers.Wait()
+}
@@ -0,0 +1,145 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/ztrue/tracerr"
+)
+
+//*****************************************************************************
+
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+//-----------------------------------------------------------------------------
+
+// auditChain links the audit records in a hash chain: every record carries
+// its sequence number, the hash of the previous record and its own hash,
+// the SHA-256 of its JSON encoding (sorted keys, without "hash"). Removing,
+// reordering or altering a record breaks the chain
+type auditChain struct {
+	mu   sync.Mutex
+	seq  uint64
+	prev string
+}
+
+//-----------------------------------------------------------------------------
+
+// seal adds the chain fields to the record and returns its hash. Caller
+// must hold mu and, once the record is posted, commit the hash
+func (a *auditChain) seal(record map[string]interface{}) (string, error) {
+	record["seq"] = a.seq
+	record["prev_hash"] = a.prev
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	record["hash"] = hash
+	return hash, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// commit moves the chain on past the record sealed with hash. Caller must
+// hold mu
+func (a *auditChain) commit(hash string) {
+	a.prev = hash
+	a.seq++
+}
+
+//-----------------------------------------------------------------------------
+
+// Audit posts an audit record to "<tag>.audit": who (the actor) did what
+// (action) on which resource (subject) and how it ended (outcome, e.g.
+// AuditSuccess). Audit records are never sampled
+func (l *Logger) Audit(c *fiber.Ctx, action, subject, outcome string) error {
+	record := map[string]interface{}{
+		"timestamp": l.now().UTC().Format(time.RFC3339Nano),
+		"actor":     l.auditActor(c),
+		"action":    action,
+		"resource":  subject,
+		"result":    outcome,
+		"method":    c.Method(),
+		"path":      c.Path(),
+		"client_ip": l.clientIP(c),
+	}
+	if id := RequestID(c); id != "" {
+		record["request_id"] = id
+	}
+	l.addGlobalFields(record)
+	l.redact(record)
+
+	// the chain hashes the values as posted, so they must not change later
+	record = cloneRecord(record)
+	return l.emitSealed(l.baseTag()+".audit", l.now(), record, &l.audit)
+}
+
+//-----------------------------------------------------------------------------
+
+// AuditLogger returns a handler auditing the requests using AuditMethods:
+// the action is the method, the resource the matched route and the outcome
+// depends on the status code
+func (l *Logger) AuditLogger() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if l.noop || l.skip(c) || !slices.Contains(l.config().AuditMethods, c.Method()) {
+			return c.Next()
+		}
+
+		err := c.Next()
+
+		outcome := AuditSuccess
+		if err != nil || c.Response().StatusCode() >= fiber.StatusBadRequest {
+			outcome = AuditFailure
+		}
+		if aerr := l.Audit(c, strings.ToLower(c.Method()), c.Route().Path, outcome); aerr != nil {
+			tracerr.PrintSource(aerr)
+		}
+
+		return err
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// auditActor returns who made the request, "" if unknown
+func (l *Logger) auditActor(c *fiber.Ctx) string {
+	config := l.config()
+	if config.AuditActor != nil {
+		return config.AuditActor(c)
+	}
+	if actor := c.Locals(config.AuditActorLocal); actor != nil {
+		return fmt.Sprint(actor)
+	}
+	if sub, ok := bearerClaims(c)["sub"].(string); ok {
+		return sub
+	}
+	return ""
+}
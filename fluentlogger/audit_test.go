@@ -0,0 +1,120 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"testing"
+	"time"
+
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+//*****************************************************************************
+
+// withCtx runs fn with a Fiber context for a GET request of path
+func withCtx(t *testing.T, path string, fn func(c *fiber.Ctx)) {
+	t.Helper()
+	app := fiber.New()
+	var fctx fasthttp.RequestCtx
+	fctx.Request.SetRequestURI(path)
+	fctx.Request.Header.SetMethod(fiber.MethodGet)
+	c := app.AcquireCtx(&fctx)
+	defer app.ReleaseCtx(c)
+	fn(c)
+}
+
+//-----------------------------------------------------------------------------
+
+// TestAuditBaseTag checks the tag of the audit records with an empty Tag
+// and a TagFunc
+func TestAuditBaseTag(t *testing.T) {
+	sink := &testSink{}
+	l := newTagFuncLogger(t, sink, "")
+	withCtx(t, "/users/1", func(c *fiber.Ctx) {
+		if err := l.Audit(c, "delete", "/users/:id", AuditSuccess); err != nil {
+			t.Fatal(err)
+		}
+	})
+	records := sink.received()
+	if want := ConfigDefault.Tag + ".audit"; len(records) != 1 || records[0].tag != want {
+		t.Errorf("got %v, want one record tagged %q", records, want)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// TestAuditChainVerifies checks that the posted audit records verify, with
+// serializers and a timestamp field changing them after Audit and records
+// left out while the logging is disabled
+func TestAuditChainVerifies(t *testing.T) {
+	sink := &testSink{}
+	l, err := NewWithSink(sink, LoggerConfig{
+		Enabled:         true,
+		Tag:             "app",
+		GlobalFields:    map[string]interface{}{"deployed": time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)},
+		Serializers:     []Serializer{TimeSerializer(time.Kitchen)},
+		TimestampField:  "ts",
+		TimestampFormat: TimestampUnixMilli,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	withCtx(t, "/users/1", func(c *fiber.Ctx) {
+		for i, enabled := range []bool{true, false, true, true} {
+			l.SetEnabled(enabled)
+			if err := l.Audit(c, "update", "/users/:id", AuditSuccess); err != nil {
+				t.Fatalf("audit %d: %v", i, err)
+			}
+		}
+	})
+
+	records := sink.received()
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3", len(records))
+	}
+	prev := ""
+	for i, r := range records {
+		record := maps.Clone(r.record)
+		hash := record["hash"]
+		delete(record, "hash")
+		data, err := json.Marshal(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(data)
+		if want := hex.EncodeToString(sum[:]); hash != want {
+			t.Errorf("record %d: hash %v, want %s", i, hash, want)
+		}
+		if seq, _ := record["seq"].(uint64); seq != uint64(i) {
+			t.Errorf("record %d: seq %v", i, record["seq"])
+		}
+		if record["prev_hash"] != prev {
+			t.Errorf("record %d: prev_hash %v, want %q", i, record["prev_hash"], prev)
+		}
+		if record["deployed"] != "12:00PM" {
+			t.Errorf("record %d: deployed %v not serialized", i, record["deployed"])
+		}
+		prev, _ = hash.(string)
+	}
+}
@@ -0,0 +1,274 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tinylib/msgp/msgp"
+	"github.com/ztrue/tracerr"
+)
+
+//*****************************************************************************
+
+// the default delay between the first record of a batch and its post
+const defaultBatchInterval = 100 * time.Millisecond
+
+//-----------------------------------------------------------------------------
+
+// batcher accumulates the records per tag and hands them to flush when a
+// batch is full or its interval expires
+type batcher struct {
+	mu       sync.Mutex
+	size     int
+	interval time.Duration
+	batches  map[string]*batch
+	flush    func(tag string, entries []queuedMessage)
+}
+
+type batch struct {
+	entries []queuedMessage
+	timer   *time.Timer
+}
+
+//-----------------------------------------------------------------------------
+
+func newBatcher(size int, interval time.Duration, flush func(string, []queuedMessage)) *batcher {
+	if interval <= 0 {
+		interval = defaultBatchInterval
+	}
+	return &batcher{
+		size:     size,
+		interval: interval,
+		batches:  make(map[string]*batch),
+		flush:    flush,
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// add appends a message, which must not change later, to the batch of its
+// tag, flushing the batch when it is full
+func (b *batcher) add(m queuedMessage) {
+	b.mu.Lock()
+	bt, ok := b.batches[m.tag]
+	if !ok {
+		bt = &batch{entries: make([]queuedMessage, 0, b.size)}
+		bt.timer = time.AfterFunc(b.interval, func() { b.expire(m.tag, bt) })
+		b.batches[m.tag] = bt
+	}
+	bt.entries = append(bt.entries, m)
+	if len(bt.entries) < b.size {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.batches, m.tag)
+	bt.timer.Stop()
+	b.mu.Unlock()
+
+	b.flush(m.tag, bt.entries)
+}
+
+//-----------------------------------------------------------------------------
+
+// expire flushes a batch whose interval is over, unless it was already
+func (b *batcher) expire(tag string, bt *batch) {
+	b.mu.Lock()
+	if b.batches[tag] != bt {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.batches, tag)
+	b.mu.Unlock()
+
+	b.flush(tag, bt.entries)
+}
+
+//-----------------------------------------------------------------------------
+
+// flushAll flushes every pending batch
+func (b *batcher) flushAll() {
+	b.mu.Lock()
+	batches := b.batches
+	b.batches = make(map[string]*batch)
+	b.mu.Unlock()
+
+	for tag, bt := range batches {
+		bt.timer.Stop()
+		b.flush(tag, bt.entries)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// postBatch writes a batch as one Forward mode message to the first endpoint
+// accepting it. When every endpoint fails, the records are posted one by one
+// so they reach the spool or the fallback writer. The sinks receive the
+// records one by one in any case
+func (l *Logger) postBatch(tag string, entries []queuedMessage) {
+	ctx, cancel := l.postContext()
+	defer cancel()
+	start := time.Now()
+	err := l.retry(ctx, func() error { return l.postForward(ctx, tag, entries) }, func(err error) {
+		l.metrics.settle(len(entries), err)
+		if err != nil {
+			l.rescueEntries(entries, err)
+		}
+	})
+	l.metrics.observe(time.Since(start), len(entries), err)
+
+	// a batch left running rescues its records itself if it fails
+	l.postEntries(entries, err != nil && !errors.Is(err, errPostAbandoned))
+}
+
+//-----------------------------------------------------------------------------
+
+// postEntries posts the records of a batch one by one, to Fluentd and the
+// sinks or only to the sinks
+func (l *Logger) postEntries(entries []queuedMessage, fluent bool) {
+	for _, m := range entries {
+		var perr error
+		if fluent {
+			perr = l.post(m.tag, m.time, m.message)
+		} else {
+			perr = l.postSinks(m.tag, m.time, m.message)
+		}
+		if perr != nil {
+			tracerr.PrintSource(perr)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// postForward writes a Forward mode message through the batch connections of
+// the endpoints, in the order given by the balance policy
+func (l *Logger) postForward(ctx context.Context, tag string, entries []queuedMessage) error {
+	var errs []error
+	for _, e := range l.endpointOrder() {
+		var err error
+		switch {
+		case e.http != nil:
+			err = e.http.post(ctx, tag, entries)
+		case e.sink != nil:
+			err = postEach(e.sink, entries)
+		default:
+			err = e.writeForward(ctx, tag, entries, l.config().AckTimeout)
+		}
+		if err == nil {
+			e.markUp()
+			return nil
+		}
+		e.markDown(time.Now(), l.config().EndpointRetryInterval)
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return errors.New("no fluentd endpoint available")
+	}
+	return errors.Join(errs...)
+}
+
+//-----------------------------------------------------------------------------
+
+// rescueEntries keeps the records of a batch Fluentd did not take, failing
+// with err, in the spool or else in the FallbackWriter
+func (l *Logger) rescueEntries(entries []queuedMessage, err error) {
+	for _, m := range entries {
+		if rerr := l.rescue(m.tag, m.time, m.message, err); rerr != nil {
+			tracerr.PrintSource(rerr)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// postEach posts the entries of a batch one by one to a sink, which has no
+// batches, stopping at the first error
+func postEach(sink Sink, entries []queuedMessage) error {
+	for _, m := range entries {
+		if err := sink.Post(m.tag, m.time, m.message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// writeForward encodes and writes a Forward mode message on the own
+// connection of the endpoint, see write
+func (e *endpoint) writeForward(ctx context.Context, tag string, entries []queuedMessage, ackTimeout time.Duration) error {
+	config := e.fluentConfig()
+	if config.TagPrefix != "" {
+		tag = config.TagPrefix + "." + tag
+	}
+	var chunk string
+	if config.RequestAck {
+		chunk = uuid.NewString()
+	}
+	var data []byte
+	var err error
+	if config.MarshalAsJSON {
+		pairs := make([][2]interface{}, len(entries))
+		for i, m := range entries {
+			pairs[i] = [2]interface{}{m.time.Unix(), m.message}
+		}
+		data, err = encodeJSON(chunk, tag, pairs)
+	} else {
+		data, err = encodeForward(tag, entries, config.SubSecondPrecision, chunk)
+	}
+	if err != nil {
+		return err
+	}
+	return e.write(ctx, data, chunk, ackTimeout)
+}
+
+//-----------------------------------------------------------------------------
+
+// encodeForward encodes [tag, [[time, record]...], option], the Forward mode
+// of the Fluentd forward protocol. The option requests an acknowledgement
+// when chunk is not empty
+func encodeForward(tag string, entries []queuedMessage, subSecond bool, chunk string) ([]byte, error) {
+	fields := uint32(2)
+	if chunk != "" {
+		fields = 3
+	}
+	b := msgp.AppendArrayHeader(nil, fields)
+	b = msgp.AppendString(b, tag)
+	b = msgp.AppendArrayHeader(b, uint32(len(entries)))
+
+	var err error
+	for _, m := range entries {
+		b = msgp.AppendArrayHeader(b, 2)
+		if b, err = appendEventTime(b, m.time, subSecond); err != nil {
+			return nil, err
+		}
+		if b, err = msgp.AppendIntf(b, m.message); err != nil {
+			return nil, err
+		}
+	}
+	if chunk != "" {
+		b = msgp.AppendMapHeader(b, 1)
+		b = msgp.AppendString(b, "chunk")
+		b = msgp.AppendString(b, chunk)
+	}
+	return b, nil
+}
@@ -0,0 +1,60 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+//*****************************************************************************
+
+// TestPostBatchLateFailure checks that a batch left running at PostTimeout
+// which then fails is spooled once, the sinks seeing each record once
+func TestPostBatchLateFailure(t *testing.T) {
+	endpoint := &testSink{delay: 100 * time.Millisecond, err: errors.New("refused")}
+	sink := &testSink{}
+	dir := t.TempDir()
+	l, err := NewWithSink(endpoint, LoggerConfig{
+		Enabled:     true,
+		Tag:         "app",
+		BatchSize:   2,
+		PostTimeout: 20 * time.Millisecond,
+		SpoolDir:    dir,
+		Sinks:       []Sink{sink},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := l.emit("app.test", map[string]interface{}{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	eventually(t, time.Second, func() bool { return spooledLines(t, dir) >= 2 })
+	time.Sleep(200 * time.Millisecond) // anything posted twice shows up by now
+	if n := spooledLines(t, dir); n != 2 {
+		t.Errorf("spooled %d records, want 2", n)
+	}
+	if n := len(sink.received()); n != 2 {
+		t.Errorf("sinks got %d records, want 2", n)
+	}
+}
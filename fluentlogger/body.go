@@ -0,0 +1,116 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"mime"
+	"strings"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// DefaultBodyContentTypes are the content types whose bodies are logged when
+// BodyContentTypes is nil. A trailing "/*" matches any subtype
+var DefaultBodyContentTypes = []string{
+	"application/json",
+	"application/xml",
+	"application/x-www-form-urlencoded",
+	"text/*",
+}
+
+//-----------------------------------------------------------------------------
+
+// addBody adds the body to the record under field if its content type is
+// allowed, marking it when it had to be truncated
+func (l *Logger) addBody(record map[string]interface{}, field string, body []byte, contentType string) {
+	if len(body) == 0 || !l.loggableContentType(contentType) {
+		return
+	}
+
+	limited := l.limitBody(body)
+	record[field] = string(limited)
+	if len(limited) < len(body) {
+		record[field+"_truncated"] = true
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// errorResponseBody tells whether LogErrorResponseBody logs the body of a
+// response with status
+func errorResponseBody(c *fiber.Ctx, config *LoggerConfig, status int) bool {
+	if config.ResponseBodyPredicate != nil {
+		return config.ResponseBodyPredicate(c, status)
+	}
+	return status >= fiber.StatusInternalServerError
+}
+
+//-----------------------------------------------------------------------------
+
+// loggableContentType tells whether bodies of contentType may be logged
+func (l *Logger) loggableContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, allowed := range l.config().BodyContentTypes {
+		allowed = strings.ToLower(allowed)
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+//-----------------------------------------------------------------------------
+
+// limitBody returns at most MaxBodyBytes bytes of body
+func (l *Logger) limitBody(body []byte) []byte {
+	config := l.config()
+	if config.MaxBodyBytes > 0 && len(body) > config.MaxBodyBytes {
+		return body[:config.MaxBodyBytes]
+	}
+	return body
+}
+
+//-----------------------------------------------------------------------------
+
+// bodyHash returns the hex encoded SHA-256 of the (limited) body
+func (l *Logger) bodyHash(body []byte) string {
+	sum := sha256.Sum256(l.limitBody(body))
+	return hex.EncodeToString(sum[:])
+}
+
+//-----------------------------------------------------------------------------
+
+// requestSize returns the Content-Length of the request or, when it is not
+// known (e.g. chunked requests), the length of the read body
+func requestSize(c *fiber.Ctx) int {
+	if n := c.Request().Header.ContentLength(); n >= 0 {
+		return n
+	}
+	return len(c.Body())
+}
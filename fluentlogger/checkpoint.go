@@ -0,0 +1,99 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"time"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// checkpointsLocal holds the *checkpoints of a request, see Checkpoint
+const checkpointsLocal = "fluentlogger.checkpoints"
+
+//-----------------------------------------------------------------------------
+
+// checkpoints are the named instants of a request, in the order reached
+type checkpoints struct {
+	now   func() time.Time // the Clock of the logger
+	start time.Time
+	names []string
+	times []time.Time
+}
+
+//-----------------------------------------------------------------------------
+
+// Checkpoint marks the end of a named stage of the request, e.g. "auth"
+// after the authentication middleware or "handler" before serializing the
+// response. With LogCheckpoints the record gets "timings_ms", the time from
+// the previous checkpoint (or the start of the request) to each of them and
+// "rest" from the last one to the end; a name used twice adds up. It does
+// nothing when the middleware is not logging checkpoints
+func Checkpoint(c *fiber.Ctx, name string) {
+	if cp, ok := c.Locals(checkpointsLocal).(*checkpoints); ok {
+		cp.names = append(cp.names, name)
+		cp.times = append(cp.times, cp.now())
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// CheckpointHandler returns a handler marking the checkpoint name and
+// passing on, to be installed right after the middleware of a stage:
+//
+//	app.Use(auth, fiberfluentdlogger.CheckpointHandler("auth"))
+func CheckpointHandler(name string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		Checkpoint(c, name)
+		return c.Next()
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// startCheckpoints stores the checkpoints of a request starting at start,
+// timed with now
+func startCheckpoints(c *fiber.Ctx, start time.Time, now func() time.Time) {
+	c.Locals(checkpointsLocal, &checkpoints{now: now, start: start})
+}
+
+//-----------------------------------------------------------------------------
+
+// timings returns the breakdown of the checkpoints of a request ending at
+// end, in milliseconds, or nil when no checkpoint was reached
+func (l *Logger) timings(c *fiber.Ctx, end time.Time) map[string]interface{} {
+	cp, ok := c.Locals(checkpointsLocal).(*checkpoints)
+	if !ok || len(cp.names) == 0 {
+		return nil
+	}
+
+	durations := make(map[string]time.Duration, len(cp.names)+1)
+	last := cp.start
+	for i, name := range cp.names {
+		durations[name] += cp.times[i].Sub(last)
+		last = cp.times[i]
+	}
+	durations["rest"] += end.Sub(last)
+
+	timings := make(map[string]interface{}, len(durations))
+	for name, d := range durations {
+		timings[name] = l.roundLatency(float64(d) / float64(time.Millisecond))
+	}
+	return timings
+}
@@ -0,0 +1,77 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"net/netip"
+	"strings"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// clientIP returns the address of the client. When the peer is one of the
+// TrustedProxies, it is taken from ClientIPHeader instead: for
+// X-Forwarded-For, the rightmost address of the chain which is not a trusted
+// proxy, since the entries on its left may be forged by the client
+func (l *Logger) clientIP(c *fiber.Ctx) string {
+	config := l.config()
+	remote := c.IP()
+	if len(config.TrustedProxies) == 0 || !l.trustedProxy(remote) {
+		return remote
+	}
+
+	value := c.Get(config.ClientIPHeader)
+	if !strings.EqualFold(config.ClientIPHeader, fiber.HeaderXForwardedFor) {
+		if addr, err := netip.ParseAddr(strings.TrimSpace(value)); err == nil {
+			return addr.String()
+		}
+		return remote
+	}
+
+	hops := strings.Split(value, ",")
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break // a malformed hop ends the part of the chain we can trust
+		}
+		client = addr.String()
+		if !l.trustedProxy(client) {
+			break
+		}
+	}
+	return client
+}
+
+//-----------------------------------------------------------------------------
+
+// trustedProxy tells whether the address belongs to TrustedProxies
+func (l *Logger) trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range l.config().TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
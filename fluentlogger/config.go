@@ -0,0 +1,141 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+//*****************************************************************************
+
+// ConfigDefault posts the access records tagged "fiber.access" to the
+// Fluentd of the local host on the standard forward port
+var ConfigDefault = LoggerConfig{
+	Enabled: true,
+	Host:    "127.0.0.1",
+	Port:    24224,
+	Tag:     "fiber.access",
+}
+
+// ErrInvalidConfig is wrapped by the errors describing the problems of a
+// configuration rejected by New
+var ErrInvalidConfig = errors.New("invalid logger config")
+
+//-----------------------------------------------------------------------------
+
+// DefaultConfig returns a copy of ConfigDefault, to be adjusted before being
+// given to New
+func DefaultConfig() LoggerConfig {
+	return ConfigDefault
+}
+
+//-----------------------------------------------------------------------------
+
+// validate returns the problems of config, joined, or nil. transport tells
+// whether the Fluentd connection options are used, as they are by New
+func validate(config LoggerConfig, transport bool) error {
+	var errs []error
+	invalid := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%w: "+format, append([]interface{}{ErrInvalidConfig}, args...)...))
+	}
+
+	if config.Tag == "" && config.TagFunc == nil {
+		invalid("empty Tag")
+	}
+	if config.SampleRate < 0 || config.SampleRate > 1 {
+		invalid("SampleRate %v out of the 0-1 range", config.SampleRate)
+	}
+	for class, rate := range config.StatusSampleRates {
+		if rate < 0 || rate > 1 {
+			invalid("StatusSampleRates[%q] %v out of the 0-1 range", class, rate)
+		}
+	}
+	for _, rule := range config.PathSampleRates {
+		if rule.Rate < 0 || rule.Rate > 1 {
+			invalid("PathSampleRates %q rate %v out of the 0-1 range", rule.Pattern, rule.Rate)
+		}
+	}
+
+	if !transport || config.DryRun || config.HTTPURL != "" {
+		return errors.Join(errs...)
+	}
+	if len(config.Endpoints) > 0 {
+		for i, ep := range config.Endpoints {
+			if ep.SocketPath != "" {
+				continue
+			}
+			if ep.Host == "" {
+				invalid("missing Host in Endpoints[%d]", i)
+			}
+			if ep.Port < 1 || ep.Port > 65535 {
+				invalid("Port %d of Endpoints[%d] out of the 1-65535 range", ep.Port, i)
+			}
+		}
+		return errors.Join(errs...)
+	}
+	if config.SocketPath != "" || (config.FluentConfig.FluentNetwork == "unix" && config.FluentConfig.FluentSocketPath != "") {
+		return errors.Join(errs...)
+	}
+
+	host, port := config.FluentConfig.FluentHost, config.FluentConfig.FluentPort
+	if config.Host != "" {
+		host = config.Host
+	}
+	if config.Port != 0 {
+		port = config.Port
+	}
+	if host == "" {
+		invalid("missing Host (or SocketPath, Endpoints, HTTPURL)")
+	}
+	if port < 1 || port > 65535 {
+		invalid("Port %d out of the 1-65535 range", port)
+	}
+	return errors.Join(errs...)
+}
+
+//-----------------------------------------------------------------------------
+
+// discardSink drops every record, the endpoint of the no-op loggers
+type discardSink struct{}
+
+//-----------------------------------------------------------------------------
+
+func (discardSink) Post(string, time.Time, interface{}) error {
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// newNoopLogger returns the logger of a disabled configuration: its
+// handlers only call c.Next() and nothing is ever posted, even after
+// SetEnabled(true)
+func newNoopLogger(config LoggerConfig) *Logger {
+	setDefaults(&config)
+
+	l := &Logger{
+		endpoints: []*endpoint{{sink: discardSink{}}},
+		started:   time.Now(),
+		abandoned: make(chan struct{}, maxAbandonedPosts),
+		stop:      make(chan struct{}),
+		noop:      true,
+	}
+	l.current.Store(&config)
+	l.disabled.Store(true)
+	return l
+}
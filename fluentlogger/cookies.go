@@ -0,0 +1,85 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"slices"
+	"strings"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// addCookieFields adds the request cookies as "cookies" and the cookies set
+// by the response as "set_cookies"
+func (l *Logger) addCookieFields(c *fiber.Ctx, record map[string]interface{}) {
+	var cookies, setCookies [][2]string
+	c.Request().Header.VisitAllCookie(func(key, value []byte) {
+		cookies = append(cookies, [2]string{string(key), string(value)})
+	})
+	c.Response().Header.VisitAllCookie(func(key, value []byte) {
+		// the value is the whole Set-Cookie header, e.g. "id=1; Path=/"
+		pair, _, _ := strings.Cut(string(value), ";")
+		_, v, _ := strings.Cut(pair, "=")
+		setCookies = append(setCookies, [2]string{string(key), strings.TrimSpace(v)})
+	})
+
+	if len(cookies) > 0 {
+		record["cookies"] = l.cookieField(cookies)
+	}
+	if len(setCookies) > 0 {
+		record["set_cookies"] = l.cookieField(setCookies)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// cookieField returns the sorted cookie names or, with LogCookieValues, a
+// name -> value map where the values of RedactCookies are masked
+func (l *Logger) cookieField(cookies [][2]string) interface{} {
+	if !l.config().LogCookieValues {
+		names := make([]string, len(cookies))
+		for i, cookie := range cookies {
+			names[i] = cookie[0]
+		}
+		slices.Sort(names)
+		return slices.Compact(names)
+	}
+
+	values := make(map[string]interface{}, len(cookies))
+	for _, cookie := range cookies {
+		if l.redactedCookie(cookie[0]) {
+			values[cookie[0]] = Redacted
+		} else {
+			values[cookie[0]] = cookie[1]
+		}
+	}
+	return values
+}
+
+//-----------------------------------------------------------------------------
+
+// redactedCookie tells whether the value of the cookie must be redacted
+func (l *Logger) redactedCookie(name string) bool {
+	for _, redacted := range l.config().RedactCookies {
+		if strings.EqualFold(name, redacted) {
+			return true
+		}
+	}
+	return false
+}
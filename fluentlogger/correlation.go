@@ -0,0 +1,73 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"strings"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// DefaultCorrelationHeaders are the correlation headers set by the usual
+// gateways and load balancers, with the fields they are logged as
+var DefaultCorrelationHeaders = map[string]string{
+	"X-Correlation-ID": "correlation_id",
+	"X-Amzn-Trace-Id":  "amzn_trace_id",
+	HeaderTraceparent:  "traceparent",
+}
+
+//-----------------------------------------------------------------------------
+
+// correlationValue returns the value of a correlation header, copied out of
+// the request buffer, or "" when absent or longer than a request ID may be
+func correlationValue(c *fiber.Ctx, header string) string {
+	value := c.Get(header)
+	if value == "" || len(value) > maxRequestIDLength {
+		return ""
+	}
+	return strings.Clone(value)
+}
+
+//-----------------------------------------------------------------------------
+
+// addCorrelationFields adds the configured correlation headers of the
+// request to the record
+func (l *Logger) addCorrelationFields(c *fiber.Ctx, record map[string]interface{}) {
+	for header, field := range l.config().CorrelationHeaders {
+		if value := correlationValue(c, header); value != "" {
+			record[field] = value
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// echoCorrelationHeaders copies the correlation headers of the request to
+// the response, when EchoCorrelationHeaders is set
+func (l *Logger) echoCorrelationHeaders(c *fiber.Ctx) {
+	config := l.config()
+	if !config.EchoCorrelationHeaders {
+		return
+	}
+	for header := range config.CorrelationHeaders {
+		if value := correlationValue(c, header); value != "" {
+			c.Set(header, value)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// isPreflight tells whether the request is a CORS preflight request
+func isPreflight(c *fiber.Ctx) bool {
+	return c.Method() == fiber.MethodOptions &&
+		c.Get(fiber.HeaderOrigin) != "" &&
+		c.Get(fiber.HeaderAccessControlRequestMethod) != ""
+}
+
+//-----------------------------------------------------------------------------
+
+// corsFields collects what the client asked for in a preflight request and
+// what the response allowed
+func corsFields(c *fiber.Ctx) map[string]interface{} {
+	fields := map[string]interface{}{
+		"origin":         c.Get(fiber.HeaderOrigin),
+		"request_method": c.Get(fiber.HeaderAccessControlRequestMethod),
+	}
+
+	if headers := c.Get(fiber.HeaderAccessControlRequestHeaders); headers != "" {
+		fields["request_headers"] = headers
+	}
+
+	response := &c.Response().Header
+	if methods := response.Peek(fiber.HeaderAccessControlAllowMethods); len(methods) > 0 {
+		fields["allow_methods"] = string(methods)
+	}
+	if headers := response.Peek(fiber.HeaderAccessControlAllowHeaders); len(headers) > 0 {
+		fields["allow_headers"] = string(headers)
+	}
+	if origin := response.Peek(fiber.HeaderAccessControlAllowOrigin); len(origin) > 0 {
+		fields["allow_origin"] = string(origin)
+	}
+
+	return fields
+}
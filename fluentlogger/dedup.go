@@ -0,0 +1,206 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// deduplicator collapses identical records within a window. The first
+// occurrence of a key is posted right away; the following ones are counted
+// and, when the window expires, flush receives the last of them along with
+// the number of suppressed occurrences
+type deduplicator struct {
+	mu      sync.Mutex
+	window  time.Duration
+	entries map[uint64]*dedupEntry
+	flush   func(tag string, record map[string]interface{}, count int)
+}
+
+type dedupEntry struct {
+	tag    string
+	record map[string]interface{}
+	count  int
+}
+
+//-----------------------------------------------------------------------------
+
+func newDeduplicator(window time.Duration, flush func(string, map[string]interface{}, int)) *deduplicator {
+	return &deduplicator{
+		window:  window,
+		entries: make(map[uint64]*dedupEntry),
+		flush:   flush,
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// add registers an occurrence of key and tells whether its record has to be
+// posted now
+func (d *deduplicator) add(key uint64, tag string, record map[string]interface{}) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if entry, ok := d.entries[key]; ok {
+		entry.tag = tag
+		entry.record = cloneRecord(record)
+		entry.count++
+		return false
+	}
+
+	d.entries[key] = &dedupEntry{}
+	time.AfterFunc(d.window, func() { d.expire(key) })
+	return true
+}
+
+//-----------------------------------------------------------------------------
+
+// expire ends the window of key, flushing the suppressed occurrences if any
+func (d *deduplicator) expire(key uint64) {
+	d.mu.Lock()
+	entry := d.entries[key]
+	delete(d.entries, key)
+	d.mu.Unlock()
+
+	if entry != nil && entry.count > 0 {
+		d.flush(entry.tag, entry.record, entry.count)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// flushAll flushes the suppressed occurrences of every open window right
+// away; the windows themselves stay open
+func (d *deduplicator) flushAll() {
+	type pending struct {
+		tag    string
+		record map[string]interface{}
+		count  int
+	}
+
+	d.mu.Lock()
+	var flushes []pending
+	for _, entry := range d.entries {
+		if entry.count > 0 {
+			flushes = append(flushes, pending{entry.tag, entry.record, entry.count})
+			entry.count = 0
+		}
+	}
+	d.mu.Unlock()
+
+	for _, p := range flushes {
+		d.flush(p.tag, p.record, p.count)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// panicKey identifies a panic by its location and message
+func panicKey(location, message string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(location))
+	h.Write([]byte{0})
+	h.Write([]byte(message))
+	return h.Sum64()
+}
+
+//-----------------------------------------------------------------------------
+
+// failureKey identifies a failed request by its method, route, status and
+// error
+func failureKey(c *fiber.Ctx, err error) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(c.Method()))
+	h.Write([]byte{0})
+	h.Write([]byte(c.Route().Path))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.Itoa(responseStatus(c, err))))
+	if err != nil {
+		h.Write([]byte{0})
+		h.Write([]byte(err.Error()))
+	}
+	return h.Sum64()
+}
+
+//-----------------------------------------------------------------------------
+
+// stackThrottle remembers when the stack of each panic was last captured
+type stackThrottle struct {
+	mu      sync.Mutex
+	window  time.Duration
+	entries map[uint64]*stackEntry
+}
+
+type stackEntry struct {
+	captured time.Time
+	repeats  int
+}
+
+// the number of entries above which the expired ones are pruned
+const stackThrottlePruneSize = 1024
+
+//-----------------------------------------------------------------------------
+
+func newStackThrottle(window time.Duration) *stackThrottle {
+	return &stackThrottle{
+		window:  window,
+		entries: make(map[uint64]*stackEntry),
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// allow tells whether the stack of the panic identified by key has to be
+// captured; otherwise it returns how many times it repeated since the
+// last capture
+func (t *stackThrottle) allow(key uint64, now time.Time) (bool, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if entry, ok := t.entries[key]; ok && now.Sub(entry.captured) < t.window {
+		entry.repeats++
+		return false, entry.repeats
+	}
+
+	if len(t.entries) >= stackThrottlePruneSize {
+		for k, entry := range t.entries {
+			if now.Sub(entry.captured) >= t.window {
+				delete(t.entries, k)
+			}
+		}
+	}
+	t.entries[key] = &stackEntry{captured: now}
+	return true, 0
+}
+
+//-----------------------------------------------------------------------------
+
+// captureStack tells whether the stack of the panic identified by key has to
+// be captured, see stackThrottle.allow
+func (l *Logger) captureStack(key uint64) (bool, int) {
+	if l.stacks == nil {
+		return true, 0
+	}
+	return l.stacks.allow(key, time.Now())
+}
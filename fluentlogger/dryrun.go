@@ -0,0 +1,60 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+//*****************************************************************************
+
+// printSink pretty-prints the records of the dry-run mode
+type printSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+//-----------------------------------------------------------------------------
+
+// newPrintSink returns a sink printing to w, os.Stdout when nil
+func newPrintSink(w io.Writer) *printSink {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &printSink{w: w}
+}
+
+//-----------------------------------------------------------------------------
+
+// Post prints the tag and time of a record followed by the record as
+// indented JSON
+func (p *printSink) Post(tag string, t time.Time, message interface{}) error {
+	data, err := json.MarshalIndent(message, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = fmt.Fprintf(p.w, "%s %s\n%s\n", t.Format(time.RFC3339Nano), tag, data)
+	return err
+}
@@ -0,0 +1,227 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fluent/fluent-logger-golang/fluent"
+)
+
+//*****************************************************************************
+
+const defaultEndpointRetryInterval = 30 * time.Second
+
+//-----------------------------------------------------------------------------
+
+// Endpoint is the address of a Fluentd server: Host and Port, or the path
+// of a unix socket
+type Endpoint struct {
+	Host       string
+	Port       int
+	SocketPath string
+}
+
+//-----------------------------------------------------------------------------
+
+// BalancePolicy tells how records are spread among several endpoints
+type BalancePolicy int
+
+const (
+	BalanceFailover   BalancePolicy = iota // the first available endpoint, in order
+	BalanceRoundRobin                      // the available endpoints in turn
+)
+
+//-----------------------------------------------------------------------------
+
+// endpoint is a Fluentd client along with its availability. TLS endpoints
+// have no client: they post through their own connection, see tlsEndpoint.
+// Neither do HTTP endpoints (see httpEndpoint) nor the sink of NewWithSink
+type endpoint struct {
+	client    *fluent.Fluent
+	config    fluent.Config // the configuration of a TLS endpoint
+	tls       *tls.Config
+	http      *httpOutput
+	sink      Sink
+	owned     bool         // whether Close has to close the client
+	downUntil atomic.Int64 // unix nanoseconds until which it is skipped
+
+	connMu sync.Mutex
+	conn   net.Conn // the own connection, for the batches and TLS, see write
+}
+
+//-----------------------------------------------------------------------------
+
+// fluentConfig returns the client configuration of the endpoint
+func (e *endpoint) fluentConfig() fluent.Config {
+	if e.client != nil {
+		return e.client.Config
+	}
+	return e.config
+}
+
+//-----------------------------------------------------------------------------
+
+func (e *endpoint) available(now time.Time) bool {
+	return now.UnixNano() >= e.downUntil.Load()
+}
+
+func (e *endpoint) markDown(now time.Time, retry time.Duration) {
+	e.downUntil.Store(now.Add(retry).UnixNano())
+}
+
+func (e *endpoint) markUp() {
+	e.downUntil.Store(0)
+}
+
+//-----------------------------------------------------------------------------
+
+// probe dials the Fluentd server of the endpoint
+func (e *endpoint) probe(ctx context.Context) error {
+	if e.sink != nil {
+		return nil
+	}
+	config := e.fluentConfig()
+	network, address := "tcp", net.JoinHostPort(config.FluentHost, strconv.Itoa(config.FluentPort))
+	switch {
+	case e.http != nil:
+		address = e.http.address
+	case config.FluentNetwork == "unix":
+		network, address = "unix", config.FluentSocketPath
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+//-----------------------------------------------------------------------------
+
+// dialEndpoints creates a client for each endpoint, or a TLS endpoint when
+// tlsConfig is set. The synchronous client connects on creation, but it is
+// kept even when that fails: it connects again on its next post, so an
+// endpoint down at startup is only marked as unavailable
+func dialEndpoints(config fluent.Config, endpoints []Endpoint, tlsConfig *tls.Config) ([]*endpoint, error) {
+	if config.MaxRetry == 0 {
+		config.MaxRetry = 1
+	}
+
+	network := config.FluentNetwork
+	if network == "unix" {
+		network = "" // the default of the client, tcp
+	}
+
+	dialed := make([]*endpoint, 0, len(endpoints))
+	down := 0
+	for _, ep := range endpoints {
+		config.FluentNetwork = network
+		config.FluentHost = ep.Host
+		config.FluentPort = ep.Port
+		if ep.SocketPath != "" {
+			config.FluentNetwork = "unix"
+			config.FluentSocketPath = ep.SocketPath
+		}
+
+		e, err := dialEndpoint(config, tlsConfig)
+		if e == nil {
+			for _, e := range dialed {
+				e.close()
+			}
+			return nil, err
+		}
+		if err != nil {
+			e.markDown(time.Now(), defaultEndpointRetryInterval)
+			down++
+		}
+		dialed = append(dialed, e)
+	}
+
+	if down == len(dialed) {
+		for _, e := range dialed {
+			e.close()
+		}
+		return nil, fmt.Errorf("no fluentd endpoint reachable")
+	}
+	return dialed, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// dialEndpoint creates the client of an endpoint, or a TLS endpoint when
+// tlsConfig is set and the endpoint is not a unix socket. A connection
+// error may come with an endpoint, which is then usable
+func dialEndpoint(config fluent.Config, tlsConfig *tls.Config) (*endpoint, error) {
+	if tlsConfig != nil && config.FluentNetwork != "unix" {
+		return tlsEndpoint(config, tlsConfig)
+	}
+	client, err := fluent.New(config)
+	if client == nil {
+		return nil, err
+	}
+	return &endpoint{client: client, owned: true}, err
+}
+
+//-----------------------------------------------------------------------------
+
+// close closes the own connection of the endpoint and, when owned, its
+// client
+func (e *endpoint) close() error {
+	e.closeConn()
+	if e.owned && e.client != nil {
+		return e.client.Close()
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// endpointOrder returns the endpoints to try for a post: the available ones
+// as the balance policy dictates, then the unavailable ones as a last resort
+func (l *Logger) endpointOrder() []*endpoint {
+	n := len(l.endpoints)
+	if n == 1 {
+		return l.endpoints
+	}
+
+	start := 0
+	if l.config().Balance == BalanceRoundRobin {
+		start = int(l.next.Add(1) % uint64(n))
+	}
+
+	now := time.Now()
+	order := make([]*endpoint, 0, n)
+	var down []*endpoint
+	for i := 0; i < n; i++ {
+		e := l.endpoints[(start+i)%n]
+		if e.available(now) {
+			order = append(order, e)
+		} else {
+			down = append(down, e)
+		}
+	}
+	return append(order, down...)
+}
@@ -0,0 +1,255 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//*****************************************************************************
+
+// NewFromEnv initializes a Fluentd logger configured by the environment on
+// top of DefaultConfig, see ConfigFromEnv
+func NewFromEnv() (*Logger, error) {
+	config, err := ConfigFromEnv(DefaultConfig())
+	if err != nil {
+		return nil, err
+	}
+	return New(config)
+}
+
+//-----------------------------------------------------------------------------
+
+// ConfigFromEnv returns base with the options set in the environment, so the
+// options which can not come from it (functions, sinks...) can still be
+// given in code. Start from DefaultConfig, as NewFromEnv does, so that only
+// FLUENT_ENABLED=false is needed to turn the logging off: a base which is
+// not Enabled gives a no-op logger. Lists are comma-separated and durations
+// are like "250ms":
+//
+//	FLUENT_ENABLED, FLUENT_HOST, FLUENT_PORT, FLUENT_SOCKET_PATH, FLUENT_TAG
+//	FLUENT_HTTP_URL, FLUENT_HTTP_GZIP, FLUENT_DRY_RUN
+//	FLUENT_ASYNC, FLUENT_TIMEOUT, FLUENT_POST_TIMEOUT, FLUENT_SUB_SECOND_PRECISION
+//	FLUENT_SKIP_PATHS, FLUENT_SKIP_METHODS
+//	FLUENT_SAMPLE_RATE, FLUENT_SLOW_THRESHOLD, FLUENT_MIN_STATUS, FLUENT_LOG_ONLY_ERRORS
+//	FLUENT_REQUEST_ID, FLUENT_LOG_HOST, FLUENT_LOG_PROTOCOL, FLUENT_LOG_TLS
+//	FLUENT_TIMESTAMP_FIELD, FLUENT_TIMESTAMP_FORMAT
+//	FLUENT_LOG_QUERY ("raw" or "parsed"), FLUENT_FIELD_FORMAT ("flat", "ecs" or "nested")
+//	FLUENT_REQUEST_HEADERS, FLUENT_RESPONSE_HEADERS, FLUENT_TRUSTED_PROXIES
+//	FLUENT_ASYNC_QUEUE_SIZE, FLUENT_ASYNC_WORKERS, FLUENT_SPOOL_DIR
+func ConfigFromEnv(base LoggerConfig) (LoggerConfig, error) {
+	config := base
+	var env envReader
+
+	env.bool("FLUENT_ENABLED", &config.Enabled)
+	env.string("FLUENT_HOST", &config.Host)
+	env.int("FLUENT_PORT", &config.Port)
+	env.string("FLUENT_SOCKET_PATH", &config.SocketPath)
+	env.string("FLUENT_HTTP_URL", &config.HTTPURL)
+	env.bool("FLUENT_HTTP_GZIP", &config.HTTPGzip)
+	env.bool("FLUENT_DRY_RUN", &config.DryRun)
+	env.string("FLUENT_TAG", &config.Tag)
+
+	env.bool("FLUENT_ASYNC", &config.FluentConfig.Async)
+	env.duration("FLUENT_TIMEOUT", &config.FluentConfig.Timeout)
+	env.duration("FLUENT_POST_TIMEOUT", &config.PostTimeout)
+	env.bool("FLUENT_SUB_SECOND_PRECISION", &config.SubSecondPrecision)
+
+	env.list("FLUENT_SKIP_PATHS", &config.SkipPaths)
+	env.list("FLUENT_SKIP_METHODS", &config.SkipMethods)
+
+	env.float("FLUENT_SAMPLE_RATE", &config.SampleRate)
+	env.duration("FLUENT_SLOW_THRESHOLD", &config.SlowRequestThreshold)
+	env.int("FLUENT_MIN_STATUS", &config.MinStatus)
+	env.bool("FLUENT_LOG_ONLY_ERRORS", &config.LogOnlyErrors)
+
+	env.bool("FLUENT_REQUEST_ID", &config.RequestID)
+	env.bool("FLUENT_LOG_HOST", &config.LogHost)
+	env.bool("FLUENT_LOG_PROTOCOL", &config.LogProtocol)
+	env.bool("FLUENT_LOG_TLS", &config.LogTLS)
+	env.string("FLUENT_TIMESTAMP_FIELD", &config.TimestampField)
+	env.string("FLUENT_TIMESTAMP_FORMAT", &config.TimestampFormat)
+
+	if value, ok := env.lookup("FLUENT_LOG_QUERY"); ok {
+		switch strings.ToLower(value) {
+		case "off":
+			config.LogQuery = QueryOff
+		case "raw":
+			config.LogQuery = QueryRaw
+		case "parsed":
+			config.LogQuery = QueryParsed
+		default:
+			env.fail("FLUENT_LOG_QUERY", fmt.Errorf("unknown mode %q", value))
+		}
+	}
+	if value, ok := env.lookup("FLUENT_FIELD_FORMAT"); ok {
+		switch strings.ToLower(value) {
+		case "flat":
+			config.FieldFormat = FormatFlat
+		case "ecs":
+			config.FieldFormat = FormatECS
+		case "nested":
+			config.FieldFormat = FormatNested
+		default:
+			env.fail("FLUENT_FIELD_FORMAT", fmt.Errorf("unknown format %q", value))
+		}
+	}
+
+	env.list("FLUENT_REQUEST_HEADERS", &config.RequestHeaders)
+	env.list("FLUENT_RESPONSE_HEADERS", &config.ResponseHeaders)
+	var proxies []string
+	env.list("FLUENT_TRUSTED_PROXIES", &proxies)
+	for _, proxy := range proxies {
+		prefix, err := parsePrefix(proxy)
+		if err != nil {
+			env.fail("FLUENT_TRUSTED_PROXIES", err)
+			break
+		}
+		config.TrustedProxies = append(config.TrustedProxies, prefix)
+	}
+
+	env.int("FLUENT_ASYNC_QUEUE_SIZE", &config.AsyncQueueSize)
+	env.int("FLUENT_ASYNC_WORKERS", &config.AsyncWorkers)
+	env.string("FLUENT_SPOOL_DIR", &config.SpoolDir)
+
+	return config, env.err
+}
+
+//-----------------------------------------------------------------------------
+
+// parsePrefix parses a CIDR, or a single address as a one-address prefix
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		return netip.ParsePrefix(s)
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+//-----------------------------------------------------------------------------
+
+// envReader sets the options found in the environment, keeping the first
+// parse error
+type envReader struct {
+	err error
+}
+
+//-----------------------------------------------------------------------------
+
+// fail records the parse error of a variable
+func (r *envReader) fail(name string, err error) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%s: %w", name, err)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// lookup returns the trimmed value of a variable, and whether it is set and
+// not empty
+func (r *envReader) lookup(name string) (string, bool) {
+	value := strings.TrimSpace(os.Getenv(name))
+	return value, value != ""
+}
+
+//-----------------------------------------------------------------------------
+
+// string sets dst to the value of a variable
+func (r *envReader) string(name string, dst *string) {
+	if value, ok := r.lookup(name); ok {
+		*dst = value
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// bool sets dst to the parsed value of a variable
+func (r *envReader) bool(name string, dst *bool) {
+	if value, ok := r.lookup(name); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			r.fail(name, err)
+			return
+		}
+		*dst = b
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// int sets dst to the parsed value of a variable
+func (r *envReader) int(name string, dst *int) {
+	if value, ok := r.lookup(name); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			r.fail(name, err)
+			return
+		}
+		*dst = n
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// float sets dst to the parsed value of a variable
+func (r *envReader) float(name string, dst *float64) {
+	if value, ok := r.lookup(name); ok {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			r.fail(name, err)
+			return
+		}
+		*dst = f
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// duration sets dst to the parsed value of a variable
+func (r *envReader) duration(name string, dst *time.Duration) {
+	if value, ok := r.lookup(name); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			r.fail(name, err)
+			return
+		}
+		*dst = d
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// list sets dst to the non-empty comma-separated items of a variable
+func (r *envReader) list(name string, dst *[]string) {
+	if value, ok := r.lookup(name); ok {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*dst = items
+	}
+}
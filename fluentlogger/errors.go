@@ -0,0 +1,160 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/ztrue/tracerr"
+)
+
+//*****************************************************************************
+
+const (
+	errorLoggedLocal = "fluentlogger.error_logged" // set by handleError
+	errorFieldsLocal = "fluentlogger.error_fields" // see AddErrorFields
+)
+
+//-----------------------------------------------------------------------------
+
+// DefaultErrorFormatter logs an error as an object Elasticsearch can query:
+// "message", the "type" of its root cause, the "chain" of the wrapped
+// messages when there are several, and the "frames" of its stack trace as
+// {"func", "file", "line"} objects when it was wrapped with tracerr
+func DefaultErrorFormatter(err error) interface{} {
+	formatted := map[string]interface{}{"message": err.Error()}
+
+	chain := []string{err.Error()}
+	root := err
+	for {
+		next := errors.Unwrap(root)
+		if next == nil {
+			break
+		}
+		if msg := next.Error(); msg != chain[len(chain)-1] { // tracerr keeps the message
+			chain = append(chain, msg)
+		}
+		root = next
+	}
+	formatted["type"] = fmt.Sprintf("%T", root)
+	if len(chain) > 1 {
+		formatted["chain"] = chain
+	}
+
+	var traced tracerr.Error
+	if errors.As(err, &traced) {
+		stack := traced.StackTrace()
+		frames := make([]map[string]interface{}, len(stack))
+		for i, frame := range stack {
+			frames[i] = map[string]interface{}{"func": frame.Func, "file": frame.Path, "line": frame.Line}
+		}
+		formatted["frames"] = frames
+	}
+	return formatted
+}
+
+//-----------------------------------------------------------------------------
+
+// SourceErrorFormatter logs an error as a string with the source excerpts of
+// its tracerr stack trace, the way the middleware used to
+func SourceErrorFormatter(err error) interface{} {
+	return tracerr.SprintSource(err)
+}
+
+//-----------------------------------------------------------------------------
+
+// addErrorFields classifies the error returned by the handlers: the code and
+// message of a *fiber.Error as "error_code" and "error_message", and
+// "error_type", one of "client", "server", "timeout" or "canceled".
+// "status_from_error" tells when the logged status is the code of the
+// *fiber.Error rather than the status of the response, which the error
+// handler has not set yet
+func addErrorFields(c *fiber.Ctx, err error, record map[string]interface{}) {
+	record["error_type"] = errorType(err)
+
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		record["error_code"] = fe.Code
+		record["error_message"] = fe.Message
+		if !ErrorLogged(c) && fe.Code != c.Response().StatusCode() {
+			record["status_from_error"] = true
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// errorType tells whose fault an error is; the errors which are neither
+// timeouts nor cancellations are the client's when they carry a 4xx code
+func errorType(err error) string {
+	if errors.Is(err, context.Canceled) {
+		return "canceled"
+	}
+
+	var timeout interface{ Timeout() bool }
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &timeout) && timeout.Timeout() {
+		return "timeout"
+	}
+
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		switch {
+		case fe.Code == fiber.StatusRequestTimeout || fe.Code == fiber.StatusGatewayTimeout:
+			return "timeout"
+		case fe.Code >= 400 && fe.Code < 500:
+			return "client"
+		}
+	}
+	return "server"
+}
+
+//-----------------------------------------------------------------------------
+
+// handleError runs the ErrorHandler of the app on the error of a handler,
+// answering 500 when it fails in turn, as Fiber does
+func handleError(c *fiber.Ctx, err error) {
+	c.Locals(errorLoggedLocal, true)
+	if herr := c.App().ErrorHandler(c, err); herr != nil {
+		_ = c.SendStatus(fiber.StatusInternalServerError)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// ErrorLogged tells an ErrorHandler whether the error it handles will be
+// logged by the middleware (see LogErrorOnce), so it can skip logging it
+func ErrorLogged(c *fiber.Ctx) bool {
+	return c.Locals(errorLoggedLocal) == true
+}
+
+//-----------------------------------------------------------------------------
+
+// AddErrorFields adds fields to the access record of the request, e.g. the
+// classification made by an ErrorHandler, so the failure is described in a
+// single record
+func AddErrorFields(c *fiber.Ctx, fields map[string]interface{}) {
+	current, _ := c.Locals(errorFieldsLocal).(map[string]interface{})
+	if current == nil {
+		current = make(map[string]interface{}, len(fields))
+		c.Locals(errorFieldsLocal, current)
+	}
+	maps.Copy(current, fields)
+}
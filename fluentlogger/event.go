@@ -0,0 +1,80 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"maps"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// Event posts an ad-hoc business event (signup, purchase...) to
+// "<tag>.<name>". The fields are copied, so the caller may reuse them. In
+// async mode the post errors are not returned but printed
+func (l *Logger) Event(name string, fields map[string]interface{}) error {
+	record := maps.Clone(fields)
+	if record == nil {
+		record = make(map[string]interface{})
+	}
+	return l.postEvent(name, record)
+}
+
+//-----------------------------------------------------------------------------
+
+// EventCtx is Event enriched with the request: its ID, path and client IP,
+// along with the fields shared by every stream
+func (l *Logger) EventCtx(c *fiber.Ctx, name string, fields map[string]interface{}) error {
+	record := l.requestFields(c)
+	maps.Copy(record, fields)
+	return l.postEvent(name, record)
+}
+
+//-----------------------------------------------------------------------------
+
+// RequestFields returns the fields EventCtx adds, copied so they can be kept
+// after the request, e.g. for the events of a WebSocket connection
+func (l *Logger) RequestFields(c *fiber.Ctx) map[string]interface{} {
+	return cloneRecord(l.requestFields(c))
+}
+
+//-----------------------------------------------------------------------------
+
+// requestFields returns the fields describing the request in the events
+func (l *Logger) requestFields(c *fiber.Ctx) map[string]interface{} {
+	record := map[string]interface{}{
+		"method":    c.Method(),
+		"path":      c.Path(),
+		"client_ip": l.clientIP(c),
+	}
+	l.addCommonFields(c, record)
+	if id := RequestID(c); id != "" {
+		record["request_id"] = id
+	}
+	return record
+}
+
+//-----------------------------------------------------------------------------
+
+// postEvent redacts and posts an event record
+func (l *Logger) postEvent(name string, record map[string]interface{}) error {
+	l.addGlobalFields(record)
+	l.redact(record)
+	l.stringifyNumbers(record)
+	return l.emit(l.baseTag()+"."+name, record)
+}
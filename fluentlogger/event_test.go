@@ -0,0 +1,66 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"testing"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// newTagFuncLogger returns a logger posting to sink with an empty Tag and a
+// TagFunc, or with the given Tag
+func newTagFuncLogger(t *testing.T, sink Sink, tag string) *Logger {
+	t.Helper()
+	l, err := NewWithSink(sink, LoggerConfig{
+		Enabled: true,
+		Tag:     tag,
+		TagFunc: func(c *fiber.Ctx) string { return "tenant.access" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+//-----------------------------------------------------------------------------
+
+// TestEventBaseTag checks the tag of the events when Tag is empty or a
+// template
+func TestEventBaseTag(t *testing.T) {
+	for _, test := range []struct {
+		tag, want string
+	}{
+		{"", ConfigDefault.Tag + ".signup"},
+		{"app.${method}", "app.signup"},
+		{"${route}", ConfigDefault.Tag + ".signup"},
+		{"app", "app.signup"},
+	} {
+		sink := &testSink{}
+		l := newTagFuncLogger(t, sink, test.tag)
+		if err := l.Event("signup", map[string]interface{}{"user": "u1"}); err != nil {
+			t.Fatal(err)
+		}
+		records := sink.received()
+		if len(records) != 1 || records[0].tag != test.want {
+			t.Errorf("Tag %q: got %v, want one record tagged %q", test.tag, records, test.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"time"
+)
+
+//*****************************************************************************
+
+// fallbackEvent is the JSON line written to FallbackWriter
+type fallbackEvent struct {
+	Tag    string      `json:"tag"`
+	Time   time.Time   `json:"time"`
+	Record interface{} `json:"record"`
+}
+
+//-----------------------------------------------------------------------------
+
+// writeFallback writes a message Fluentd did not accept to FallbackWriter
+func (l *Logger) writeFallback(tag string, t time.Time, message interface{}) error {
+	data, err := json.Marshal(fallbackEvent{Tag: tag, Time: t, Record: message})
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	l.fallbackMu.Lock()
+	defer l.fallbackMu.Unlock()
+	_, err = l.config().FallbackWriter.Write(data)
+	return err
+}
@@ -17,121 +17,995 @@ limitations under the License.
 */
 
 import (
+	"crypto/tls"
 	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"runtime/debug"
-
 	"github.com/fluent/fluent-logger-golang/fluent"
 	fiber "github.com/gofiber/fiber/v2"
-	"github.com/ztrue/tracerr"
+	"github.com/google/uuid"
 )
 
 //*****************************************************************************
 
 type LoggerConfig struct {
-	Enabled bool // whether the middleware is enabled
-	Host string // the fluentd server address
-	Port int    // the fluentd server port
-	Tag  string // the tag to be used for the messages
+	// Next defines a function to skip the middleware when it returns true
+	Next func(c *fiber.Ctx) bool
+
+	// SkipPaths and SkipMethods skip the middleware for the matching
+	// requests, in addition to Next. Paths are glob patterns (see matchPath)
+	SkipPaths   []string
+	SkipMethods []string
+
+	Enabled bool   // whether the middleware is enabled
+	Host    string // the fluentd server address
+	Port    int    // the fluentd server port
+	Tag     string // the tag to be used for the messages, see also expandTag and baseTag
+
+	// SocketPath, when set, connects to Fluentd (or a Fluent Bit sidecar)
+	// through this unix socket instead of Host and Port. TLS does not apply
+	// to it
+	SocketPath string
+
+	// TagFunc, when set, returns the tag of each request instead of Tag
+	TagFunc func(c *fiber.Ctx) string
+
+	// GlobalFields are added to every record, e.g. the service name and
+	// environment (see DefaultGlobalFields); the fields of the record win
+	GlobalFields map[string]interface{}
+
+	// KubernetesMetadata adds KubernetesFields to GlobalFields, so records
+	// name their pod even without the Kubernetes filter of Fluentd
+	KubernetesMetadata bool
+
+	// FluentConfig is passed to fluent.New, so every option of the client
+	// (Timeout, BufferLimit, Async, MaxRetry...) can be set. Host and Port,
+	// when set, take precedence over FluentHost and FluentPort
+	FluentConfig fluent.Config
+
+	// SubSecondPrecision posts the event times with nanosecond precision
+	// (the EventTime of the forward protocol, Fluentd v0.14 or later). It
+	// is the same as setting FluentConfig.SubSecondPrecision
+	SubSecondPrecision bool
+
+	// RequestAck makes Fluentd acknowledge every message (and batch), so a
+	// lost one is retried and then spooled or written to the FallbackWriter
+	// like any failed post; in FluentConfig.Async mode the failures come
+	// back through the AsyncResultCallback of the client. AckTimeout (5
+	// seconds by default) bounds the wait for the acknowledgement of a batch
+	RequestAck bool
+	AckTimeout time.Duration
+
+	// MarshalAsJSON encodes the messages as JSON rather than MessagePack,
+	// for plugin chains that choke on some MessagePack types. It is the same
+	// as setting FluentConfig.MarshalAsJSON
+	MarshalAsJSON bool
+
+	// Serializers convert the record values before they are posted, the
+	// first one applying to a value winning; see TimeSerializer,
+	// ErrorSerializer and StringerSerializer
+	Serializers []Serializer
+
+	// TLS, when set, connects to Fluentd over TLS, verifying the server
+	// against CAFile and presenting CertFile for mutual TLS. The records are
+	// then written by the middleware rather than the client, which cannot do
+	// either: FluentConfig.Async and the buffer and retries of the client
+	// are ignored, so use AsyncQueueSize and PostRetries instead
+	TLS *TLSConfig
+
+	// HTTPURL, when set, replaces the forward protocol: the records are
+	// posted as JSON arrays to the HTTP input of Fluentd (in_http) or Fluent
+	// Bit at this URL, e.g. "http://fluentd:9880", the tag being the path.
+	// HTTPGzip compresses the requests, HTTPHeaders are added to them (e.g.
+	// an Authorization) and HTTPClient, when set, sends them. Combine it with
+	// BatchSize to post several records per request
+	HTTPURL     string
+	HTTPGzip    bool
+	HTTPHeaders map[string]string
+	HTTPClient  *http.Client
+
+	// DryRun prints the records to DryRunWriter (os.Stdout by default) as
+	// indented JSON instead of sending them to Fluentd, to see what would be
+	// shipped while working locally
+	DryRun       bool
+	DryRunWriter io.Writer
+
+	// Endpoints, when set, replaces Host, Port and SocketPath with several
+	// Fluentd servers sharing FluentConfig. Balance tells how records are
+	// spread among them; an endpoint failing a post is skipped for
+	// EndpointRetryInterval (30 seconds by default) or until a health check
+	// finds it back. Keep FluentConfig.MaxRetry low (1 by default here) so
+	// a failing endpoint is abandoned quickly
+	Endpoints             []Endpoint
+	Balance               BalancePolicy
+	EndpointRetryInterval time.Duration
+
+	// PostRetries retries the failed posts with an exponential backoff
+	// starting at PostRetryWait (50ms by default) and capped at
+	// PostRetryMaxWait (2 seconds by default), jittered. In sync mode the
+	// retries delay the requests, so prefer them with AsyncQueueSize
+	PostRetries      int
+	PostRetryWait    time.Duration
+	PostRetryMaxWait time.Duration
+
+	// PostTimeout, when set, bounds every post, retries included, so a
+	// wedged Fluentd connection can't stall the requests: past it the post
+	// fails with ErrPostTimeout and the record goes to the spool or the
+	// FallbackWriter. It is also the default FluentConfig.WriteTimeout
+	PostTimeout time.Duration
+
+	// BreakerThreshold, when set, opens a circuit breaker after this many
+	// consecutive failed posts: for BreakerCooldown (30 seconds by default)
+	// no post is attempted and the records go straight to the spool or the
+	// FallbackWriter. Then a single post probes Fluentd again
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// StringifyNumbers lists the integer fields (e.g. "response_size") which
+	// are emitted as strings, so consumers that parse JSON numbers as float64
+	// do not lose precision
+	StringifyNumbers []string
+
+	LogHost   bool // whether to log the request hostname as "host"
+	HostAsTag bool // whether to append the sanitized hostname to the tag
+
+	// LogProtocol logs the HTTP version (e.g. "HTTP/1.1") as "protocol" and
+	// the scheme as "scheme"; combine it with LogHost for the Host header
+	LogProtocol bool
+
+	// TrustedProxies are the load balancers and proxies in front of the
+	// app. For the requests they forward, "client_ip" is taken from
+	// ClientIPHeader (X-Forwarded-For by default; X-Real-IP and
+	// CF-Connecting-IP hold a single address) instead of the peer address
+	TrustedProxies []netip.Prefix
+	ClientIPHeader string
+
+	// GeoIP, when set, adds the location of "client_ip" as "geo_country",
+	// "geo_region" and "geo_city"
+	GeoIP GeoIP
+
+	StatusClassTag bool // whether to append the status class (e.g. "5xx") to the access tag
+
+	// StaticPrefixes lists the path prefixes served with app.Static; when
+	// set, every record carries a "static" field telling whether the request
+	// hit one of them
+	StaticPrefixes []string
+
+	// ResponseHeaderFields maps response header names to the fields they
+	// are logged as, e.g. {"X-Cache": "cache_status"}; missing headers are
+	// omitted
+	ResponseHeaderFields map[string]string
+
+	// CompactFields, when set, makes access records be posted as an array
+	// holding the values of these fields in this order instead of a map
+	CompactFields []string
+
+	// FieldFormat shapes the access records, FormatFlat by default
+	FieldFormat FieldFormat
+
+	// Fields, when set, is the allowlist of the access fields to keep and
+	// FieldMap renames them (e.g. {"latency_ms": "duration"}). Both use the
+	// names of this package and apply before FieldFormat
+	Fields   []string
+	FieldMap map[string]string
+
+	// CombinedLog adds an Apache/NGINX combined log format line as
+	// "message", or makes it the only field of the access records
+	CombinedLog CombinedLogMode
+
+	LogAuthScheme bool // whether to log the Authorization scheme as "auth_scheme"
+
+	// JWTClaims lists the claims (e.g. "sub", "aud", "scope") logged under
+	// "jwt_claims". They are returned by ClaimsExtractor or else decoded
+	// from the bearer token WITHOUT verifying its signature
+	JWTClaims       []string
+	ClaimsExtractor func(c *fiber.Ctx) map[string]interface{}
+
+	GenerateID  bool          // whether to add a unique "log_id" to every record
+	IDGenerator func() string // the generator for the IDs, UUIDv4 by default
+
+	// RequestID reads the request ID from RequestIDHeader (X-Request-ID by
+	// default) or generates one with IDGenerator, stores it in
+	// c.Locals(RequestIDLocal), echoes it in the response and logs it as
+	// "request_id"
+	RequestID       bool
+	RequestIDHeader string
+
+	// CorrelationHeaders maps the correlation headers of the requests to the
+	// fields they are logged as in every stream, e.g.
+	// DefaultCorrelationHeaders, so the records can be joined with the logs
+	// of upstream gateways. EchoCorrelationHeaders sends them back in the
+	// responses. Values longer than 128 bytes are ignored
+	CorrelationHeaders     map[string]string
+	EchoCorrelationHeaders bool
+
+	// LogTraceContext logs "trace_id" and "span_id" from TraceExtractor
+	// when set (e.g. reading the OpenTelemetry span of c.UserContext()),
+	// falling back to the W3C traceparent header
+	LogTraceContext bool
+	TraceExtractor  func(c *fiber.Ctx) (traceID, spanID string)
+
+	// DetectReplays flags requests whose method, path and body were already
+	// seen within ReplayWindow with "replay": true. It is a probabilistic
+	// signal, see replayDetector
+	DetectReplays  bool
+	ReplayWindow   time.Duration // how long a signature is remembered, 1 minute by default
+	ReplayCapacity int           // how many signatures are remembered, 10000 by default
+
+	LogCORS bool // whether to log the CORS negotiation of preflight requests as "cors"
+
+	HashRequestBody bool // whether to log the SHA-256 of the request body as "request_body_hash"
+	MaxBodyBytes    int  // the maximum number of body bytes read, 0 means no limit
+
+	// LogRequestBody and LogResponseBody log the bodies, up to MaxBodyBytes,
+	// as "request_body" and "response_body" when their content type is in
+	// BodyContentTypes (DefaultBodyContentTypes when nil). Cut bodies get a
+	// "request_body_truncated" or "response_body_truncated" field
+	LogRequestBody   bool
+	LogResponseBody  bool
+	BodyContentTypes []string
+
+	// LogErrorResponseBody logs the response body like LogResponseBody, but
+	// only for the 5xx responses or, when ResponseBodyPredicate is set (it
+	// enables the mode by itself), those it accepts. The body written by the
+	// error handler is only seen with LogErrorOnce
+	LogErrorResponseBody  bool
+	ResponseBodyPredicate func(c *fiber.Ctx, status int) bool
+
+	// Sinks are additional destinations receiving every record sent to
+	// Fluentd, e.g. a JSONSink on stdout or a file; wrap them in a
+	// FilteredSink to give each its own filter and sample rate
+	Sinks []Sink
+
+	// FallbackWriter, when set, receives the records Fluentd did not accept
+	// as JSON lines ({"tag":..., "time":..., "record":...}), e.g. os.Stderr
+	// or a file, so they are not lost during outages
+	FallbackWriter io.Writer
+
+	// SpoolDir, when set, is where the records Fluentd did not accept are
+	// appended, to be replayed in order once it is back. Files rotate at
+	// SpoolFileMaxBytes (8 MiB by default) and records are dropped while the
+	// spool holds SpoolMaxBytes (256 MiB by default). The FallbackWriter is
+	// only used when spooling fails
+	SpoolDir          string
+	SpoolMaxBytes     int64
+	SpoolFileMaxBytes int64
+
+	// PanicDedupWindow, when set, collapses identical panics (same location
+	// and message) into one record per window carrying a "panic_count"
+	PanicDedupWindow time.Duration
+
+	// ErrorDedupWindow, when set, collapses the identical failed requests
+	// (those returning an error or a 5xx with the same method, route,
+	// status and error) into one record per window carrying an
+	// "error_count", so a failing dependency does not flood Fluentd
+	ErrorDedupWindow time.Duration
+
+	// PanicStackWindow, when set, captures the stack trace of a given panic
+	// at most once per window; repeats only log their message and a
+	// "panic_repeats" count, sparing the capture cost during crash loops
+	PanicStackWindow time.Duration
+
+	// PanicRecover makes PanicLogger turn panics into the response built by
+	// PanicHandler (a 500 fiber.Error by default) instead of panicking again
+	// after logging them
+	PanicRecover bool
+	PanicHandler func(c *fiber.Ctx, recovered interface{}) error
+
+	// AsyncQueueSize, when set, moves posting off the request path: records
+	// go through a queue of this size drained by AsyncWorkers goroutines
+	// (1 by default). OverflowPolicy decides what happens when it is full
+	AsyncQueueSize int
+	AsyncWorkers   int
+	OverflowPolicy OverflowPolicy
+
+	// BatchSize, when set, packs up to BatchSize records of a tag in one
+	// Forward mode message, posted when it is full or BatchInterval (100ms
+	// by default) after its first record. Batches are written on their own
+	// connection; when no endpoint takes a batch, its records are posted one
+	// by one, reaching the spool or the FallbackWriter
+	BatchSize     int
+	BatchInterval time.Duration
+
+	IncludeUptime bool // whether to log the seconds since New as "uptime_seconds"
+
+	// LogClientCertSubject logs the subject DN and serial of a verified
+	// mTLS client certificate as "client_cert_subject" and "client_cert_serial"
+	LogClientCertSubject bool
+
+	// LogTLS logs the TLS version, cipher suite and SNI server name of TLS
+	// requests as "tls_version", "tls_cipher_suite" and "tls_server_name",
+	// and whether a client certificate was presented as "tls_client_cert"
+	LogTLS bool
+
+	LogLatencySeconds bool // whether to also log the latency in fractional seconds as "latency_s"
+	LogLatencyNanos   bool // whether to also log the latency in nanoseconds as "latency_ns"
+	LatencyMsFloat    bool // whether "latency_ms" is fractional instead of whole milliseconds
+	LatencyPrecision  int  // the decimal places of float latencies, 0 keeps full precision
+
+	// LogTimestamps logs when the request was received and when its
+	// response was finished as "received_at" and "finished_at" (RFC 3339
+	// with nanoseconds, UTC)
+	LogTimestamps bool
+
+	// TimestampField, when set, adds the event time to every record under
+	// this name, for the stores ignoring the Fluentd time. TimestampFormat
+	// is a time layout applied in UTC (time.RFC3339Nano by default) or one
+	// of the numeric formats, e.g. TimestampUnixMilli
+	TimestampField  string
+	TimestampFormat string
+
+	// Clock returns the current time, time.Now by default; the event times
+	// and latencies come from it, so a fixed clock makes records
+	// deterministic in tests
+	Clock func() time.Time
+
+	// LogStreams posts the records of the streamed responses (SendStream,
+	// server-sent events written through SetBodyStreamWriter) once the
+	// stream ends, with the bytes actually sent and the time spent
+	// streaming, instead of when the handler returns
+	LogStreams bool
+
+	// Route, when set, receives every finished access record and returns the
+	// tag and the record to be posted; an empty tag skips the post. The
+	// record is reused once posted, so it must not be kept
+	Route func(*fiber.Ctx, map[string]interface{}) (string, map[string]interface{})
+
+	// CounterLocals lists the c.Locals keys of per-request integer counters
+	// (see IncrementCounter and DBQueriesLocal), logged under the same name
+	CounterLocals []string
+
+	// LocalsKeys copies c.Locals values (e.g. the user or tenant ID stored
+	// by an auth middleware) into every record, mapping each key to its
+	// field name; an empty name keeps the key. Absent values are omitted
+	LocalsKeys map[string]string
+
+	// StableSchema makes every access record carry the fields of
+	// StableFields (DefaultStableFields when empty, with the zero "error"
+	// of the type ErrorFormatter returns), using the given zero values for
+	// the ones that are absent
+	StableSchema bool
+	StableFields map[string]interface{}
+
+	// HealthCheckInterval, when set, makes a background goroutine verify
+	// the Fluentd server is reachable at this interval, see Healthy
+	HealthCheckInterval time.Duration
+
+	// HealthPath, when set, is where Register exposes HealthHandler
+	HealthPath string
+
+	LogQueryKeys bool // whether to log the sorted query parameter names as "query_keys"
+
+	// LogQuery logs the query string as "query", raw or parsed into a map.
+	// The values of the parameters in RedactQueryParams
+	// (DefaultRedactQueryParams when nil, case-insensitive) are replaced
+	// with "[REDACTED]"
+	LogQuery          QueryMode
+	RedactQueryParams []string
+
+	// DetectLatencyAnomalies flags with "latency_anomaly": true the requests
+	// whose latency exceeds LatencyAnomalyFactor times the rolling average
+	// of their route, computed over roughly LatencyBaselineWindow requests
+	DetectLatencyAnomalies bool
+	LatencyBaselineWindow  int     // 100 by default
+	LatencyAnomalyFactor   float64 // 3 by default
+
+	// UserAgentParser, when set, parses the User-Agent into the
+	// "user_agent_parsed" sub-map, e.g. ParseUserAgent; the raw "user_agent"
+	// is kept unless OmitRawUserAgent is set
+	UserAgentParser  func(string) map[string]interface{}
+	OmitRawUserAgent bool
+
+	// LogSpawnedJobs logs the IDs of the background jobs the request
+	// enqueued (see AddSpawnedJob) as "spawned_jobs"
+	LogSpawnedJobs bool
+
+	// LogCheckpoints logs the time spent in each stage of the request, as
+	// marked with Checkpoint, under "timings_ms"
+	LogCheckpoints bool
+
+	// ErrorFormatter turns the error returned by the handlers into the
+	// "error" field, DefaultErrorFormatter (an object) by default; see
+	// SourceErrorFormatter for a string with source excerpts
+	ErrorFormatter func(error) interface{}
+
+	// LogErrorOnce makes the middleware pass the errors of the handlers to
+	// the ErrorHandler of the app itself, like Fiber's logger does, then log
+	// the request with the status it set and return nil, so the error is
+	// neither handled nor logged again further up. An ErrorHandler logging
+	// errors can check ErrorLogged and add its fields with AddErrorFields
+	LogErrorOnce bool
+
+	// UpstreamSampling honors the sampling decision of upstream services:
+	// SampleHeader ("X-Log-Sample" by default, "1"/"0") or else the sampled
+	// flag of the W3C traceparent header. Requests marked as not sampled are
+	// not logged, unless they failed, those marked as sampled are always
+	// logged
+	UpstreamSampling bool
+	SampleHeader     string
+
+	// SampleRate is the fraction of requests logged, from 0 to 1; 0 (the
+	// default) disables sampling. StatusSampleRates overrides it per status
+	// class ("2xx", "4xx"...) and PathSampleRates, checked in order and
+	// first, per route or path pattern (see SampleRule). Requests whose
+	// handler returned an error or with a 5xx status are always logged,
+	// unless the "5xx" rate of StatusSampleRates is set
+	SampleRate        float64
+	StatusSampleRates map[string]float64
+	PathSampleRates   []SampleRule
+
+	// SlowRequestThreshold, when set, marks the requests taking longer with
+	// "slow": true and logs them whatever the sampling decision. With
+	// RouteSlowRequests they go to "<tag>.slow"
+	SlowRequestThreshold time.Duration
+	RouteSlowRequests    bool
+
+	// MinStatus, when set, only logs the requests with at least this status
+	// code or whose handler returned an error. LogOnlyErrors is MinStatus 400
+	MinStatus     int
+	LogOnlyErrors bool
+
+	// AuditActor returns the actor of audit records; by default it is
+	// c.Locals(AuditActorLocal) ("user" by default) or else the "sub" claim
+	// of the bearer token. AuditMethods are the methods AuditLogger records
+	// (POST, PUT, PATCH and DELETE by default)
+	AuditActor      func(c *fiber.Ctx) string
+	AuditActorLocal string
+	AuditMethods    []string
+
+	// Enrichers run on every record after the built-in fields are collected,
+	// e.g. to add tenant IDs or feature flags
+	Enrichers []func(*fiber.Ctx, map[string]interface{})
+
+	// RequestHeaders and ResponseHeaders list the headers logged in
+	// "request_headers" and "response_headers". The values of those in
+	// RedactHeaders (DefaultRedactHeaders when nil) are replaced with
+	// "[REDACTED]"
+	RequestHeaders  []string
+	ResponseHeaders []string
+	RedactHeaders   []string
+
+	// LogCookies logs the names of the request cookies as "cookies" and of
+	// the cookies set by the response as "set_cookies". With
+	// LogCookieValues they are name -> value maps instead, where the values
+	// of RedactCookies (case-insensitive) are always replaced with
+	// "[REDACTED]"
+	LogCookies      bool
+	LogCookieValues bool
+	RedactCookies   []string
+
+	// RedactKeys (case-insensitive key names such as "password") and
+	// RedactPatterns mask sensitive data in every record before it is
+	// posted, including inside JSON and form bodies
+	RedactKeys     []string
+	RedactPatterns []*regexp.Regexp
+}
+
+//-----------------------------------------------------------------------------
+
+// Sink is a destination for the records besides Fluentd, see the syslogsink
+// package for an example. The messages may be reused once Post returns, so
+// they must be encoded or copied rather than kept
+type Sink interface {
+	Post(tag string, t time.Time, message interface{}) error
 }
 
 //-----------------------------------------------------------------------------
 
 // Logger is a struct that holds the Fluentd logger instance and configuration
 type Logger struct {
-	client *fluent.Fluent
-	tag    string
+	endpoints []*endpoint
+	next      atomic.Uint64 // the round robin counter
+	breaker   breaker
+	current   atomic.Pointer[LoggerConfig]
+	disabled  atomic.Bool // set by SetEnabled(false)
+	noop      bool        // whether the logger was created disabled
+	replays   *replayDetector
+	panics    *deduplicator
+	failures  *deduplicator
+	stacks    *stackThrottle
+	latency   *latencyBaseline
+	started   time.Time
+
+	batches  *batcher
+	queue    chan queuedMessage
+	queueMu  sync.RWMutex // guards queue against sends after Close
+	closed   bool
+	inFlight atomic.Int64  // queued and not yet posted messages
+	dropped  atomic.Uint64 // messages dropped by the overflow policy
+	metrics  metrics
+	workers  sync.WaitGroup
+
+	abandoned chan struct{} // the timed out posts still running, see tryPost
+
+	fallbackMu sync.Mutex // serializes the writes to FallbackWriter
+	audit      auditChain
+	spool      *spool
+
+	stop      chan struct{}
+	closeOnce sync.Once
 }
 
 //-----------------------------------------------------------------------------
 
-// New initializes a Fluentd logger and returns a middleware
+// New initializes a Fluentd logger and returns a middleware, or a no-op one
+// when config is not Enabled. Start from DefaultConfig: the zero Host and
+// Port, and the zero Tag without a TagFunc, are rejected with an error
+// wrapping ErrInvalidConfig
 func New(config LoggerConfig) (*Logger, error) {
 	if !config.Enabled {
-		return nil, fmt.Errorf("middleware disabled")
+		return newNoopLogger(config), nil
+	}
+	if err := validate(config, true); err != nil {
+		return nil, err
 	}
 
 	// Initialize Fluentd logger
-	fluentLogger, err := fluent.New(fluent.Config{
-		FluentHost: config.Host,
-		FluentPort: config.Port,
-	})
-	if err != nil {
+	fluentConfig := config.FluentConfig
+	if config.Host != "" {
+		fluentConfig.FluentHost = config.Host
+	}
+	if config.Port != 0 {
+		fluentConfig.FluentPort = config.Port
+	}
+	if config.SocketPath != "" {
+		fluentConfig.FluentNetwork = "unix"
+		fluentConfig.FluentSocketPath = config.SocketPath
+	}
+	if config.SubSecondPrecision {
+		fluentConfig.SubSecondPrecision = true
+	}
+	if config.RequestAck {
+		fluentConfig.RequestAck = true
+	}
+	if config.MarshalAsJSON {
+		fluentConfig.MarshalAsJSON = true
+	}
+	if config.PostTimeout > 0 && fluentConfig.WriteTimeout == 0 {
+		fluentConfig.WriteTimeout = config.PostTimeout
+	}
+	var l *Logger
+	if fluentConfig.Async {
+		fluentConfig.AsyncResultCallback = asyncResultCallback(fluentConfig, &l)
+	}
+
+	var tlsConfig *tls.Config
+	if config.TLS != nil {
+		var err error
+		if tlsConfig, err = config.TLS.build(); err != nil {
+			return nil, err
+		}
+	}
+
+	var endpoints []*endpoint
+	if config.DryRun {
+		endpoints = []*endpoint{{sink: newPrintSink(config.DryRunWriter)}}
+	} else if config.HTTPURL != "" {
+		e, err := httpEndpoint(config.HTTPURL, config)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = []*endpoint{e}
+	} else if len(config.Endpoints) > 0 {
+		var err error
+		if endpoints, err = dialEndpoints(fluentConfig, config.Endpoints, tlsConfig); err != nil {
+			return nil, err
+		}
+	} else {
+		e, err := dialEndpoint(fluentConfig, tlsConfig)
+		if err != nil {
+			if e != nil {
+				e.close()
+			}
+			return nil, err
+		}
+		endpoints = []*endpoint{e}
+	}
+
+	l = newLogger(endpoints, config)
+	if err := l.openSpool(); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// NewWithClient returns a middleware which posts through an existing client,
+// e.g. one shared with other subsystems. The connection options of config
+// are ignored and Close leaves the client open
+func NewWithClient(client *fluent.Fluent, config LoggerConfig) (*Logger, error) {
+	if !config.Enabled {
+		return newNoopLogger(config), nil
+	}
+	if client == nil {
+		return nil, fmt.Errorf("nil fluent client")
+	}
+	if err := validate(config, false); err != nil {
 		return nil, err
 	}
 
-	return &Logger{
-		client: fluentLogger,
-		tag:    config.Tag,
-	}, nil
+	l := newLogger([]*endpoint{{client: client}}, config)
+	if err := l.openSpool(); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
 }
 
 //-----------------------------------------------------------------------------
 
-// Logger logs each request to Fluentd
-func (l *Logger) Logger() fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		start := time.Now()
-		err := c.Next() // Process the request
-		latency := time.Since(start)
-
-		// Log data to Fluentd
-		logData := map[string]interface{}{
-			"method":        c.Method(),
-			"path":          c.Path(),
-			"status":        c.Response().StatusCode(),
-			"latency_ms":    latency.Milliseconds(),
-			"client_ip":     c.IP(),
-			"user_agent":    c.Get("User-Agent"),
-			"response_size": len(c.Response().Body()),
-		}
-		if err != nil {
-			logData["error"] = tracerr.SprintSource(err)
-		}
+// NewWithSink returns a middleware which posts to sink in place of Fluentd,
+// with the same retries, spooling and batching; the connection options of
+// config are ignored. It is meant for the tests (see the fluenttest
+// package) and for the destinations other than Fluentd
+func NewWithSink(sink Sink, config LoggerConfig) (*Logger, error) {
+	if !config.Enabled {
+		return newNoopLogger(config), nil
+	}
+	if sink == nil {
+		return nil, fmt.Errorf("nil sink")
+	}
+	if err := validate(config, false); err != nil {
+		return nil, err
+	}
+
+	l := newLogger([]*endpoint{{sink: sink}}, config)
+	if err := l.openSpool(); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// newLogger sets the defaults of config and builds the Logger around the
+// endpoints
+func newLogger(endpoints []*endpoint, config LoggerConfig) *Logger {
+	setDefaults(&config)
 
-		// Send to Fluentd
-		if err := l.client.Post(l.tag, logData); err != nil {
-			tracerr.PrintSource(err)
+	l := &Logger{
+		endpoints: endpoints,
+		started:   time.Now(),
+		abandoned: make(chan struct{}, maxAbandonedPosts),
+	}
+	l.current.Store(&config)
+	if config.DetectReplays {
+		l.replays = newReplayDetector(config.ReplayWindow, config.ReplayCapacity)
+	}
+	if config.DetectLatencyAnomalies {
+		l.latency = newLatencyBaseline(config.LatencyBaselineWindow, config.LatencyAnomalyFactor)
+	}
+	l.stop = make(chan struct{})
+	if config.HealthCheckInterval > 0 {
+		go l.healthCheck(config.HealthCheckInterval)
+	}
+	if config.BatchSize > 0 {
+		l.batches = newBatcher(config.BatchSize, config.BatchInterval, l.postBatch)
+	}
+	if config.AsyncQueueSize > 0 {
+		l.startWorkers(config.AsyncQueueSize, config.AsyncWorkers)
+	}
+	if config.PanicStackWindow > 0 {
+		l.stacks = newStackThrottle(config.PanicStackWindow)
+	}
+	if config.PanicDedupWindow > 0 {
+		l.panics = newDeduplicator(config.PanicDedupWindow, func(tag string, record map[string]interface{}, count int) {
+			record["panic_count"] = count
+			l.stringifyNumbers(record)
+			l.send(tag, record)
+		})
+	}
+	if config.ErrorDedupWindow > 0 {
+		l.failures = newDeduplicator(config.ErrorDedupWindow, func(tag string, record map[string]interface{}, count int) {
+			record["error_count"] = count
+			l.stringifyNumbers(record)
+			var message interface{} = record
+			if len(l.config().CompactFields) > 0 {
+				message = l.compact(record)
+			}
+			l.send(tag, message)
+		})
+	}
+
+	return l
+}
+
+//-----------------------------------------------------------------------------
+
+// setDefaults sets the default values of the unset options
+func setDefaults(config *LoggerConfig) {
+	if config.BodyContentTypes == nil {
+		config.BodyContentTypes = DefaultBodyContentTypes
+	}
+	if config.RedactHeaders == nil {
+		config.RedactHeaders = DefaultRedactHeaders
+	}
+	if config.RedactQueryParams == nil {
+		config.RedactQueryParams = DefaultRedactQueryParams
+	}
+	if config.ClientIPHeader == "" {
+		config.ClientIPHeader = fiber.HeaderXForwardedFor
+	}
+	if config.RequestIDHeader == "" {
+		config.RequestIDHeader = fiber.HeaderXRequestID
+	}
+	if config.AuditActorLocal == "" {
+		config.AuditActorLocal = "user"
+	}
+	if config.AuditMethods == nil {
+		config.AuditMethods = []string{fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete}
+	}
+	if config.LogOnlyErrors && config.MinStatus == 0 {
+		config.MinStatus = fiber.StatusBadRequest
+	}
+	if config.SampleHeader == "" {
+		config.SampleHeader = "X-Log-Sample"
+	}
+	if config.PanicHandler == nil {
+		config.PanicHandler = func(*fiber.Ctx, interface{}) error {
+			return fiber.ErrInternalServerError
 		}
+	}
+	if config.IDGenerator == nil {
+		config.IDGenerator = uuid.NewString
+	}
+	if config.ErrorFormatter == nil {
+		config.ErrorFormatter = DefaultErrorFormatter
+	}
+	if config.StableSchema && len(config.StableFields) == 0 {
+		config.StableFields = DefaultStableFields()
+		config.StableFields["error"] = errorZero(config.ErrorFormatter)
+	}
+	if config.Clock == nil {
+		config.Clock = time.Now
+	}
 
-		return err
+	if config.EndpointRetryInterval <= 0 {
+		config.EndpointRetryInterval = defaultEndpointRetryInterval
+	}
+
+	if config.KubernetesMetadata {
+		fields := KubernetesFields()
+		maps.Copy(fields, config.GlobalFields)
+		config.GlobalFields = fields
 	}
 }
 
 //-----------------------------------------------------------------------------
 
-// PanicLogger logs details on panic to Fluentd
-func (l *Logger) PanicLogger() fiber.Handler {
-	return func(c *fiber.Ctx) error {
+// Logger logs each request to Fluentd
+func (l *Logger) Logger() fiber.Handler {
+	return func(c *fiber.Ctx) (result error) {
+		config := l.config()
+		if l.noop || l.disabled.Load() || l.skip(c) {
+			return c.Next()
+		}
+		if config.RequestID {
+			l.ensureRequestID(c)
+		}
+		l.echoCorrelationHeaders(c)
+
+		start := l.now()
+		if config.LogCheckpoints {
+			startCheckpoints(c, start, config.Clock)
+		}
 		err := c.Next() // Process the request
+		if err != nil && config.LogErrorOnce {
+			handleError(c, err)
+			defer func() { result = nil }()
+		}
+		latency := l.now().Sub(start)
 
-		// Check if there was a panic (status code 500 indicates a server error)
-		if c.Response().StatusCode() == fiber.StatusInternalServerError {
-			// Log data to Fluentd
-			logData := map[string]interface{}{
-				"method":     c.Method(),
-				"path":       c.Path(),
-				"client_ip":  c.IP(),
-				"user_agent": c.Get("User-Agent"),
-			}
+		if err == nil && c.Response().StatusCode() < config.MinStatus {
+			return nil
+		}
 
-			// Optionally, include the details of the err
-			if err != nil {
-				logData["error"] = tracerr.SprintSource(err)
+		logRequestBody, logResponseBody := config.LogRequestBody, config.LogResponseBody
+		if !logResponseBody && (config.LogErrorResponseBody || config.ResponseBodyPredicate != nil) {
+			logResponseBody = errorResponseBody(c, config, responseStatus(c, err))
+		}
+		if opts := routeOptions(c); opts != nil {
+			if opts.Skip {
+				return err
+			}
+			if opts.LogRequestBody != nil {
+				logRequestBody = *opts.LogRequestBody
+			}
+			if opts.LogResponseBody != nil {
+				logResponseBody = *opts.LogResponseBody
 			}
+		}
+
+		slow := config.SlowRequestThreshold > 0 && latency >= config.SlowRequestThreshold
+		if !slow && !l.sampled(c, err) {
+			return err
+		}
 
-			// Optionally, include stack trace if err is a panic
-			if err != nil {
-				logData["stacktrace"] = string(debug.Stack())
+		// Log data to Fluentd. The record is pooled, so neither the sinks nor
+		// the Route hook may keep it once they return
+		logData := getRecord()
+		defer putRecord(logData)
+		logData["method"] = c.Method()
+		logData["path"] = c.Path()
+		logData["route"] = c.Route().Path
+		logData["status"] = responseStatus(c, err)
+		if config.LatencyMsFloat {
+			logData["latency_ms"] = l.roundLatency(float64(latency) / float64(time.Millisecond))
+		} else {
+			logData["latency_ms"] = latency.Milliseconds()
+		}
+		logData["client_ip"] = l.clientIP(c)
+		logData["user_agent"] = c.Get(fiber.HeaderUserAgent)
+		logData["request_size"] = requestSize(c)
+		logData["response_size"] = responseSize(c)
+		l.addCommonFields(c, logData)
+		if config.GeoIP != nil {
+			l.addGeoFields(logData["client_ip"].(string), logData)
+		}
+		if config.LogProtocol {
+			logData["protocol"] = string(c.Request().Header.Protocol())
+			logData["scheme"] = c.Protocol()
+		}
+		if slow {
+			logData["slow"] = true
+		}
+		if config.LogLatencySeconds {
+			logData["latency_s"] = l.roundLatency(latency.Seconds())
+		}
+		if config.LogLatencyNanos {
+			logData["latency_ns"] = latency.Nanoseconds()
+		}
+		if config.LogTimestamps {
+			logData["received_at"] = start.UTC().Format(time.RFC3339Nano)
+			logData["finished_at"] = start.Add(latency).UTC().Format(time.RFC3339Nano)
+		}
+		l.addTimestamp(logData, start) // before CompactFields can pick it
+		if config.UserAgentParser != nil {
+			if parsed := config.UserAgentParser(c.Get(fiber.HeaderUserAgent)); len(parsed) > 0 {
+				logData["user_agent_parsed"] = parsed
+			}
+			if config.OmitRawUserAgent {
+				delete(logData, "user_agent")
+			}
+		}
+		if l.latency != nil {
+			logData["latency_anomaly"] = l.latency.observe(c.Method()+" "+c.Route().Path, latency)
+		}
+		if len(config.StaticPrefixes) > 0 {
+			logData["static"] = l.isStatic(c)
+		}
+		if config.LogQueryKeys {
+			if keys := queryKeys(c); len(keys) > 0 {
+				logData["query_keys"] = keys
 			}
+		}
+		if query := l.query(c); query != nil {
+			logData["query"] = query
+		}
+		if l.replays != nil {
+			logData["replay"] = l.replays.seen(requestSignature(c), start)
+		}
+		if config.LogAuthScheme {
+			logData["auth_scheme"] = authScheme(c.Get(fiber.HeaderAuthorization))
+		}
+		if len(config.JWTClaims) > 0 {
+			if claims := l.jwtClaims(c); len(claims) > 0 {
+				logData["jwt_claims"] = claims
+			}
+		}
+		if logRequestBody {
+			l.addBody(logData, "request_body", c.Body(), string(c.Request().Header.ContentType()))
+		}
+		if logResponseBody {
+			l.addBody(logData, "response_body", c.Response().Body(), string(c.Response().Header.ContentType()))
+		}
+		if config.HashRequestBody {
+			logData["request_body_hash"] = l.bodyHash(c.Body())
+		}
+		if config.LogClientCertSubject {
+			addClientCertFields(c, logData)
+		}
+		if config.LogTLS {
+			addTLSFields(c, logData)
+		}
+		if config.LogCORS && isPreflight(c) {
+			logData["cors"] = corsFields(c)
+		}
+		if headers := l.requestHeaders(c); len(headers) > 0 {
+			logData["request_headers"] = headers
+		}
+		if headers := l.responseHeaders(c); len(headers) > 0 {
+			logData["response_headers"] = headers
+		}
+		if config.LogCookies {
+			l.addCookieFields(c, logData)
+		}
+		l.addResponseHeaderFields(c, logData)
+		l.addCounters(c, logData)
+		if config.LogSpawnedJobs {
+			if jobs := spawnedJobs(c); len(jobs) > 0 {
+				logData["spawned_jobs"] = jobs
+			}
+		}
+		if config.LogCheckpoints {
+			if timings := l.timings(c, start.Add(latency)); timings != nil {
+				logData["timings_ms"] = timings
+			}
+		}
+		if err != nil {
+			logData["error"] = config.ErrorFormatter(err)
+			addErrorFields(c, err, logData)
+		}
+		if fields, ok := c.Locals(errorFieldsLocal).(map[string]interface{}); ok {
+			maps.Copy(logData, fields)
+		}
+		if isWebSocketUpgrade(c) {
+			logData["websocket_upgrade"] = true // see the websocketlog package
+		}
+		if c.Locals(panickedLocal) == true {
+			logData["panic"] = true
+		}
+		l.enrich(c, logData)
+		l.redact(logData)
+		if config.StableSchema {
+			l.stabilize(logData)
+		}
 
-			// Send to Fluentd
-			if err := l.client.Post(l.tag+".panic", logData); err != nil {
-				tracerr.PrintSource(err)
+		l.stringifyNumbers(logData)
+		logData = l.selectFields(logData)
+		switch config.CombinedLog {
+		case CombinedLogField:
+			logData["message"] = l.combinedLogLine(c, start, err)
+		case CombinedLogOnly:
+			logData = map[string]interface{}{"message": l.combinedLogLine(c, start, err)}
+		}
+		switch config.FieldFormat {
+		case FormatECS:
+			logData = toECS(logData, start, latency)
+		case FormatNested:
+			logData = toNested(logData)
+		}
+
+		tag := l.requestTag(c)
+		if config.StatusClassTag {
+			tag += "." + statusClass(responseStatus(c, err))
+		}
+		if slow && config.RouteSlowRequests {
+			tag += ".slow"
+		}
+		if config.Route != nil {
+			if tag, logData = config.Route(c, logData); tag == "" {
+				return err
+			}
+		}
+		if l.failures != nil && (err != nil || responseStatus(c, err) >= fiber.StatusInternalServerError) {
+			if !l.failures.add(failureKey(c, err), tag, logData) {
+				return err
 			}
+			logData["error_count"] = 1
+		}
+		if config.LogStreams && c.Response().IsBodyStream() && l.sendAfterStream(c, tag, start, logData) {
+			return err
 		}
 
+		var message interface{} = logData
+		if len(config.CompactFields) > 0 {
+			message = l.compact(logData)
+		}
+
+		// Send to Fluentd, timestamped with the start of the request
+		l.sendAt(tag, start, message)
+
 		return err
 	}
 }
@@ -0,0 +1,211 @@
+// Package fluenttest provides an in-memory sink and assertion helpers, so
+// the records of the middleware can be checked in unit tests without a
+// Fluentd server.
+package fluenttest
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	fiberfluentdlogger "github.com/rgglez/gofiber-fluent-middleware/fluentlogger"
+)
+
+//*****************************************************************************
+
+// Record is a message received by the Sink
+type Record struct {
+	Tag     string
+	Time    time.Time
+	Message interface{}            // the message as posted, copied
+	Fields  map[string]interface{} // the message when it is a map, nil otherwise
+}
+
+//-----------------------------------------------------------------------------
+
+// Sink keeps in memory the records posted to it. It is safe for concurrent
+// use, e.g. with the async mode of the middleware
+type Sink struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+//-----------------------------------------------------------------------------
+
+// NewSink returns an empty sink
+func NewSink() *Sink {
+	return &Sink{}
+}
+
+//-----------------------------------------------------------------------------
+
+// NewLogger returns a middleware posting to a new sink instead of Fluentd,
+// config being enabled for the caller and tagged as ConfigDefault when it
+// has no Tag
+func NewLogger(config fiberfluentdlogger.LoggerConfig) (*fiberfluentdlogger.Logger, *Sink, error) {
+	sink := NewSink()
+	config.Enabled = true
+	if config.Tag == "" {
+		config.Tag = fiberfluentdlogger.ConfigDefault.Tag
+	}
+	l, err := fiberfluentdlogger.NewWithSink(sink, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return l, sink, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// Post implements fiberfluentdlogger.Sink. The message is copied, since the
+// middleware reuses it once posted
+func (s *Sink) Post(tag string, t time.Time, message interface{}) error {
+	record := Record{Tag: strings.Clone(tag), Time: t, Message: clone(message)}
+	record.Fields, _ = record.Message.(map[string]interface{})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// Records returns the records received so far, in order
+func (s *Sink) Records() []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Record(nil), s.records...)
+}
+
+//-----------------------------------------------------------------------------
+
+// Reset forgets the records received so far
+func (s *Sink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = nil
+}
+
+//-----------------------------------------------------------------------------
+
+// Find returns the records having every field of match, e.g.
+// {"status": 404, "path": "/x"}. Values are compared by their fmt.Sprint
+// representation, so 404 matches an int as well as an int64 or a "404"
+func (s *Sink) Find(match map[string]interface{}) []Record {
+	var found []Record
+	for _, record := range s.Records() {
+		if matches(record, match) {
+			found = append(found, record)
+		}
+	}
+	return found
+}
+
+//-----------------------------------------------------------------------------
+
+// AssertRecord fails the test unless a record has every field of match, and
+// returns the first one found
+func (s *Sink) AssertRecord(t testing.TB, match map[string]interface{}) Record {
+	t.Helper()
+	found := s.Find(match)
+	if len(found) == 0 {
+		t.Fatalf("no record with %v among %d: %v", match, len(s.Records()), s.Records())
+		return Record{}
+	}
+	return found[0]
+}
+
+//-----------------------------------------------------------------------------
+
+// AssertNoRecord fails the test if a record has every field of match
+func (s *Sink) AssertNoRecord(t testing.TB, match map[string]interface{}) {
+	t.Helper()
+	if found := s.Find(match); len(found) > 0 {
+		t.Fatalf("unexpected record with %v: %v", match, found[0].Message)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// AssertCount fails the test unless exactly n records were received
+func (s *Sink) AssertCount(t testing.TB, n int) {
+	t.Helper()
+	if got := len(s.Records()); got != n {
+		t.Fatalf("got %d records, want %d", got, n)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// matches tells whether a record has every field of match. The "tag" key,
+// unless the record has such a field, matches the tag
+func matches(record Record, match map[string]interface{}) bool {
+	for k, want := range match {
+		got, ok := record.Fields[k]
+		if !ok && k == "tag" {
+			got, ok = record.Tag, true
+		}
+		if !ok || fmt.Sprint(got) != fmt.Sprint(want) {
+			return false
+		}
+	}
+	return true
+}
+
+//-----------------------------------------------------------------------------
+
+// clone copies a message, the strings included: those of Fiber point into
+// buffers that are reused
+func clone(message interface{}) interface{} {
+	switch v := message.(type) {
+	case string:
+		return strings.Clone(v)
+	case []byte:
+		return append([]byte(nil), v...)
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			c[strings.Clone(k)] = clone(value)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, value := range v {
+			c[i] = clone(value)
+		}
+		return c
+	case []string:
+		c := make([]string, len(v))
+		for i, value := range v {
+			c[i] = strings.Clone(value)
+		}
+		return c
+	case map[string]string:
+		c := make(map[string]string, len(v))
+		for k, value := range v {
+			c[strings.Clone(k)] = strings.Clone(value)
+		}
+		return c
+	default:
+		return v
+	}
+}
@@ -0,0 +1,146 @@
+package fluenttest
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+//*****************************************************************************
+
+// fakeTB records the failures of the helpers instead of failing the test
+type fakeTB struct {
+	testing.TB
+	failed bool
+	msg    string
+}
+
+//-----------------------------------------------------------------------------
+
+func (f *fakeTB) Helper() {}
+
+//-----------------------------------------------------------------------------
+
+// Fatalf records the failure; unlike testing.T it returns to the helper
+func (f *fakeTB) Fatalf(format string, args ...interface{}) {
+	f.failed = true
+	f.msg = fmt.Sprintf(format, args...)
+}
+
+//-----------------------------------------------------------------------------
+
+// newTestSink returns a sink holding an access and an event record
+func newTestSink(t *testing.T) *Sink {
+	t.Helper()
+	sink := NewSink()
+	records := []struct {
+		tag     string
+		message map[string]interface{}
+	}{
+		{"app", map[string]interface{}{"path": "/x", "status": 404}},
+		{"app.signup", map[string]interface{}{"user": "u1"}},
+	}
+	for _, r := range records {
+		if err := sink.Post(r.tag, time.Now(), r.message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return sink
+}
+
+//-----------------------------------------------------------------------------
+
+// TestAssertRecord checks that AssertRecord passes and returns the record
+// found, and fails when there is none
+func TestAssertRecord(t *testing.T) {
+	sink := newTestSink(t)
+
+	tb := &fakeTB{}
+	record := sink.AssertRecord(tb, map[string]interface{}{"status": "404", "path": "/x"})
+	if tb.failed {
+		t.Errorf("AssertRecord failed: %s", tb.msg)
+	}
+	if record.Tag != "app" {
+		t.Errorf("AssertRecord returned %v, want the app record", record)
+	}
+
+	tb = &fakeTB{}
+	sink.AssertRecord(tb, map[string]interface{}{"tag": "app.signup", "user": "u1"})
+	if tb.failed {
+		t.Errorf("AssertRecord by tag failed: %s", tb.msg)
+	}
+
+	tb = &fakeTB{}
+	record = sink.AssertRecord(tb, map[string]interface{}{"status": 500})
+	if !tb.failed {
+		t.Error("AssertRecord passed without a matching record")
+	}
+	if record.Tag != "" {
+		t.Errorf("AssertRecord returned %v on failure, want the zero Record", record)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// TestAssertNoRecord checks that AssertNoRecord passes without a matching
+// record and fails with one
+func TestAssertNoRecord(t *testing.T) {
+	sink := newTestSink(t)
+
+	tb := &fakeTB{}
+	sink.AssertNoRecord(tb, map[string]interface{}{"status": 500})
+	if tb.failed {
+		t.Errorf("AssertNoRecord failed: %s", tb.msg)
+	}
+
+	tb = &fakeTB{}
+	sink.AssertNoRecord(tb, map[string]interface{}{"user": "u1"})
+	if !tb.failed {
+		t.Error("AssertNoRecord passed with a matching record")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// TestAssertCount checks that AssertCount passes with the number of records
+// received and fails with any other
+func TestAssertCount(t *testing.T) {
+	sink := newTestSink(t)
+
+	tb := &fakeTB{}
+	sink.AssertCount(tb, 2)
+	if tb.failed {
+		t.Errorf("AssertCount failed: %s", tb.msg)
+	}
+
+	for _, n := range []int{0, 1, 3} {
+		tb = &fakeTB{}
+		sink.AssertCount(tb, n)
+		if !tb.failed {
+			t.Errorf("AssertCount(%d) passed with 2 records", n)
+		}
+	}
+
+	sink.Reset()
+	tb = &fakeTB{}
+	sink.AssertCount(tb, 0)
+	if tb.failed {
+		t.Errorf("AssertCount after Reset failed: %s", tb.msg)
+	}
+}
@@ -0,0 +1,246 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// FieldFormat tells how the access records are shaped
+type FieldFormat int
+
+const (
+	FormatFlat   FieldFormat = iota // a flat map with the field names of this package
+	FormatECS                       // nested per the Elastic Common Schema
+	FormatNested                    // grouped in objects such as "http", "client" and "response"
+)
+
+// CombinedLogMode tells whether the access records carry a line in the
+// combined log format
+type CombinedLogMode int
+
+const (
+	CombinedLogOff   CombinedLogMode = iota
+	CombinedLogField                 // add the line as "message"
+	CombinedLogOnly                  // post only the line, as "message"
+)
+
+// the time layout of the combined log format
+const combinedTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// the ECS version the records follow
+const ecsVersion = "8.11.0"
+
+// ecsFields maps the flat field names to their dotted ECS names
+var ecsFields = map[string]string{
+	"method":              "http.request.method",
+	"path":                "url.path",
+	"status":              "http.response.status_code",
+	"client_ip":           "client.ip",
+	"geo_country":         "client.geo.country_iso_code",
+	"geo_region":          "client.geo.region_name",
+	"geo_city":            "client.geo.city_name",
+	"user_agent":          "user_agent.original",
+	"request_size":        "http.request.body.bytes",
+	"response_size":       "http.response.body.bytes",
+	"host":                "url.domain",
+	"scheme":              "url.scheme",
+	"request_id":          "http.request.id",
+	"log_id":              "event.id",
+	"trace_id":            "trace.id",
+	"span_id":             "span.id",
+	"error":               "error.message",
+	"error_code":          "error.code",
+	"request_body":        "http.request.body.content",
+	"response_body":       "http.response.body.content",
+	"request_body_hash":   "http.request.body.hash",
+	"client_cert_subject": "tls.client.subject",
+	"client_cert_serial":  "tls.client.serial_number",
+	"tls_cipher_suite":    "tls.cipher",
+	"tls_server_name":     "tls.client.server_name",
+	"finished_at":         "event.end",
+}
+
+// nestedFields maps the flat field names to their place in FormatNested
+var nestedFields = map[string]string{
+	"method":                  "http.method",
+	"path":                    "http.path",
+	"route":                   "http.route",
+	"host":                    "http.host",
+	"protocol":                "http.protocol",
+	"scheme":                  "http.scheme",
+	"request_id":              "http.request_id",
+	"query_keys":              "http.query_keys",
+	"query":                   "http.query",
+	"request_headers":         "http.headers",
+	"request_body":            "http.body",
+	"request_body_truncated":  "http.body_truncated",
+	"request_body_hash":       "http.body_hash",
+	"auth_scheme":             "http.auth_scheme",
+	"cors":                    "http.cors",
+	"request_size":            "http.request_size",
+	"latency_ms":              "http.latency_ms",
+	"latency_s":               "http.latency_s",
+	"latency_ns":              "http.latency_ns",
+	"received_at":             "http.received_at",
+	"finished_at":             "http.finished_at",
+	"client_ip":               "client.ip",
+	"geo_country":             "client.geo.country",
+	"geo_region":              "client.geo.region",
+	"geo_city":                "client.geo.city",
+	"user_agent":              "client.user_agent",
+	"user_agent_parsed":       "client.user_agent_parsed",
+	"client_cert_subject":     "client.cert_subject",
+	"client_cert_serial":      "client.cert_serial",
+	"tls_version":             "tls.version",
+	"tls_cipher_suite":        "tls.cipher_suite",
+	"tls_server_name":         "tls.server_name",
+	"tls_client_cert":         "tls.client_cert",
+	"status":                  "response.status",
+	"response_size":           "response.size",
+	"response_headers":        "response.headers",
+	"cookies":                 "http.cookies",
+	"set_cookies":             "response.set_cookies",
+	"response_body":           "response.body",
+	"response_body_truncated": "response.body_truncated",
+}
+
+//-----------------------------------------------------------------------------
+
+// toNested returns the record with its fields grouped per nestedFields;
+// the other fields stay at the top level
+func toNested(record map[string]interface{}) map[string]interface{} {
+	nested := make(map[string]interface{}, len(record))
+	for name, value := range record {
+		if dotted, ok := nestedFields[name]; ok {
+			setDotted(nested, dotted, value)
+		} else if _, taken := nested[name]; !taken {
+			nested[name] = value
+		}
+	}
+	return nested
+}
+
+//-----------------------------------------------------------------------------
+
+// toECS returns the record shaped per ECS. The latency becomes
+// event.duration in nanoseconds; fields without an ECS counterpart are kept
+// at the top level as custom fields
+func toECS(record map[string]interface{}, start time.Time, latency time.Duration) map[string]interface{} {
+	ecs := map[string]interface{}{
+		"@timestamp": start.UTC().Format(time.RFC3339Nano),
+		"ecs":        map[string]interface{}{"version": ecsVersion},
+	}
+	setDotted(ecs, "event.duration", latency.Nanoseconds())
+	setDotted(ecs, "event.start", start.UTC().Format(time.RFC3339Nano))
+	setDotted(ecs, "event.kind", "event")
+
+	for name, value := range record {
+		switch name {
+		case "latency_ms", "latency_s", "latency_ns", "received_at":
+			continue // event.duration and event.start
+		case "error":
+			if formatted, ok := value.(map[string]interface{}); ok {
+				setECSError(ecs, formatted)
+				continue
+			}
+		}
+		if dotted, ok := ecsFields[name]; ok {
+			setDotted(ecs, dotted, value)
+		} else {
+			ecs[name] = value
+		}
+	}
+	return ecs
+}
+
+//-----------------------------------------------------------------------------
+
+// setECSError maps an error made by DefaultErrorFormatter to the ECS error
+// fields, the frames becoming error.stack_trace
+func setECSError(ecs map[string]interface{}, formatted map[string]interface{}) {
+	for name, value := range formatted {
+		switch name {
+		case "frames":
+			frames, _ := value.([]map[string]interface{})
+			var trace strings.Builder
+			for _, frame := range frames {
+				fmt.Fprintf(&trace, "%v\n\t%v:%v\n", frame["func"], frame["file"], frame["line"])
+			}
+			setDotted(ecs, "error.stack_trace", trace.String())
+		default:
+			setDotted(ecs, "error."+name, value)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// setDotted sets value at the nested path given by a dotted name
+func setDotted(record map[string]interface{}, dotted string, value interface{}) {
+	parts := strings.Split(dotted, ".")
+	group(record, parts[:len(parts)-1])[parts[len(parts)-1]] = value
+}
+
+//-----------------------------------------------------------------------------
+
+// combinedLogLine formats the request in the combined log format:
+//
+//	client - user [time] "method uri protocol" status bytes "referer" "user-agent"
+//
+// The query parameters are redacted as in the "query" field and the
+// sensitive patterns from the whole line
+func (l *Logger) combinedLogLine(c *fiber.Ctx, start time.Time, err error) string {
+	size := "-"
+	if n := responseSize(c); n > 0 {
+		size = strconv.Itoa(n)
+	}
+	uri := c.Path()
+	if query := l.rawQuery(c); query != "" {
+		uri += "?" + query
+	}
+
+	line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s \"%s\" \"%s\"",
+		l.clientIP(c),
+		dashIfEmpty(l.auditActor(c)),
+		start.Format(combinedTimeLayout),
+		c.Method(),
+		uri,
+		string(c.Request().Header.Protocol()),
+		responseStatus(c, err),
+		size,
+		dashIfEmpty(c.Get(fiber.HeaderReferer)),
+		dashIfEmpty(c.Get(fiber.HeaderUserAgent)),
+	)
+	return l.redactString(line)
+}
+
+//-----------------------------------------------------------------------------
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
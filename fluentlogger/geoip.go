@@ -0,0 +1,62 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"net/netip"
+)
+
+//*****************************************************************************
+
+// GeoLocation is the location of a client address
+type GeoLocation struct {
+	Country string // the ISO 3166-1 country code, e.g. "MX"
+	Region  string // the name of the main subdivision (state, province...)
+	City    string
+}
+
+// GeoIP resolves the location of client addresses, see the geoipmmdb package
+// for a MaxMind implementation
+type GeoIP interface {
+	Lookup(ip netip.Addr) (GeoLocation, error)
+}
+
+//-----------------------------------------------------------------------------
+
+// addGeoFields adds the location of the client IP as "geo_country",
+// "geo_region" and "geo_city". Unknown parts, and addresses the lookup
+// fails for, are omitted
+func (l *Logger) addGeoFields(ip string, record map[string]interface{}) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return
+	}
+	location, err := l.config().GeoIP.Lookup(addr.Unmap())
+	if err != nil {
+		return
+	}
+
+	for field, value := range map[string]string{
+		"geo_country": location.Country,
+		"geo_region":  location.Region,
+		"geo_city":    location.City,
+	} {
+		if value != "" {
+			record[field] = value
+		}
+	}
+}
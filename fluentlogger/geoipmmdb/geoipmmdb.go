@@ -0,0 +1,77 @@
+// Package geoipmmdb provides a GeoIP resolver for the middleware reading
+// MaxMind GeoIP2 / GeoLite2 City databases (.mmdb files). It is a module of
+// its own, so the middleware itself does not depend on the MaxMind readers.
+package geoipmmdb
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/oschwald/geoip2-golang"
+	fiberfluentdlogger "github.com/rgglez/gofiber-fluent-middleware/fluentlogger"
+)
+
+//*****************************************************************************
+
+// Reader resolves client addresses with a MaxMind City database
+type Reader struct {
+	db       *geoip2.Reader
+	language string
+}
+
+//-----------------------------------------------------------------------------
+
+// Open opens the database at path. The region and city names are given in
+// language (e.g. "en", "es"), English when empty
+func Open(path, language string) (*Reader, error) {
+	db, err := geoip2.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if language == "" {
+		language = "en"
+	}
+	return &Reader{db: db, language: language}, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// Lookup returns the location of ip
+func (r *Reader) Lookup(ip netip.Addr) (fiberfluentdlogger.GeoLocation, error) {
+	city, err := r.db.City(net.IP(ip.AsSlice()))
+	if err != nil {
+		return fiberfluentdlogger.GeoLocation{}, err
+	}
+
+	location := fiberfluentdlogger.GeoLocation{
+		Country: city.Country.IsoCode,
+		City:    city.City.Names[r.language],
+	}
+	if len(city.Subdivisions) > 0 {
+		location.Region = city.Subdivisions[0].Names[r.language]
+	}
+	return location, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// Close closes the database
+func (r *Reader) Close() error {
+	return r.db.Close()
+}
@@ -0,0 +1,31 @@
+module github.com/rgglez/gofiber-fluent-middleware/fluentlogger/geoipmmdb
+
+go 1.23.2
+
+require (
+	github.com/oschwald/geoip2-golang v1.11.0
+	github.com/rgglez/gofiber-fluent-middleware v0.0.0-00010101000000-000000000000
+)
+
+require (
+	github.com/andybalholm/brotli v1.1.0 // indirect
+	github.com/fluent/fluent-logger-golang v1.9.0 // indirect
+	github.com/gofiber/fiber/v2 v2.52.5 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/klauspost/compress v1.17.7 // indirect
+	github.com/kr/pretty v0.3.1 // indirect
+	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/mattn/go-runewidth v0.0.15 // indirect
+	github.com/oschwald/maxminddb-golang v1.13.0 // indirect
+	github.com/philhofer/fwd v1.1.2 // indirect
+	github.com/rivo/uniseg v0.2.0 // indirect
+	github.com/tinylib/msgp v1.1.8 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/valyala/fasthttp v1.52.0 // indirect
+	github.com/valyala/tcplisten v1.0.0 // indirect
+	github.com/ztrue/tracerr v0.4.0 // indirect
+	golang.org/x/sys v0.20.0 // indirect
+)
+
+replace github.com/rgglez/gofiber-fluent-middleware => ../..
@@ -0,0 +1,77 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"os"
+	"runtime/debug"
+)
+
+//*****************************************************************************
+
+// DefaultGlobalFields returns GlobalFields naming the process: "service" and
+// "environment" (omitted when empty), "hostname", "pid" and "version", the
+// module version of the binary or else its VCS revision
+func DefaultGlobalFields(service, environment string) map[string]interface{} {
+	fields := map[string]interface{}{
+		"pid": os.Getpid(),
+	}
+	if service != "" {
+		fields["service"] = service
+	}
+	if environment != "" {
+		fields["environment"] = environment
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		fields["hostname"] = hostname
+	}
+	if version := buildVersion(); version != "" {
+		fields["version"] = version
+	}
+	return fields
+}
+
+//-----------------------------------------------------------------------------
+
+// buildVersion returns the main module version recorded in the binary, or
+// its VCS revision for development builds
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+	return ""
+}
+
+//-----------------------------------------------------------------------------
+
+// addGlobalFields adds the GlobalFields the record does not set already
+func (l *Logger) addGlobalFields(record map[string]interface{}) {
+	for name, value := range l.config().GlobalFields {
+		if _, ok := record[name]; !ok {
+			record[name] = value
+		}
+	}
+}
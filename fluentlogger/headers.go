@@ -0,0 +1,98 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"strings"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// Redacted replaces the values that must not be logged
+const Redacted = "[REDACTED]"
+
+// DefaultRedactHeaders are the headers redacted when RedactHeaders is nil
+var DefaultRedactHeaders = []string{
+	fiber.HeaderAuthorization,
+	fiber.HeaderProxyAuthorization,
+	fiber.HeaderCookie,
+	fiber.HeaderSetCookie,
+	"X-Api-Key",
+}
+
+//-----------------------------------------------------------------------------
+
+// requestHeaders returns the allowed request headers present in the request,
+// redacting the sensitive ones
+func (l *Logger) requestHeaders(c *fiber.Ctx) map[string]interface{} {
+	config := l.config()
+	if len(config.RequestHeaders) == 0 {
+		return nil
+	}
+
+	headers := make(map[string]interface{}, len(config.RequestHeaders))
+	for _, name := range config.RequestHeaders {
+		value := c.Get(name)
+		if value == "" {
+			continue
+		}
+		if l.redactedHeader(name) {
+			value = Redacted
+		}
+		headers[name] = value
+	}
+	return headers
+}
+
+//-----------------------------------------------------------------------------
+
+// responseHeaders returns the allowed response headers set by the handlers,
+// redacting the sensitive ones
+func (l *Logger) responseHeaders(c *fiber.Ctx) map[string]interface{} {
+	config := l.config()
+	if len(config.ResponseHeaders) == 0 {
+		return nil
+	}
+
+	headers := make(map[string]interface{}, len(config.ResponseHeaders))
+	for _, name := range config.ResponseHeaders {
+		value := c.Response().Header.Peek(name)
+		if len(value) == 0 {
+			continue
+		}
+		if l.redactedHeader(name) {
+			headers[name] = Redacted
+		} else {
+			headers[name] = string(value)
+		}
+	}
+	return headers
+}
+
+//-----------------------------------------------------------------------------
+
+// redactedHeader tells whether the value of the header must be redacted
+func (l *Logger) redactedHeader(name string) bool {
+	for _, redacted := range l.config().RedactHeaders {
+		if strings.EqualFold(name, redacted) {
+			return true
+		}
+	}
+	return false
+}
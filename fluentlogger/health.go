@@ -0,0 +1,106 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// the bound of the probes of HealthHandler
+const defaultPingTimeout = 2 * time.Second
+
+//-----------------------------------------------------------------------------
+
+// Healthy tells whether a Fluentd server was reachable on the last health
+// check or post, whichever happened last
+func (l *Logger) Healthy() bool {
+	now := time.Now()
+	for _, e := range l.endpoints {
+		if e.available(now) {
+			return true
+		}
+	}
+	return false
+}
+
+//-----------------------------------------------------------------------------
+
+// Ping dials the Fluentd servers, updating their availability like a health
+// check, and returns nil once one of them is reachable
+func (l *Logger) Ping(ctx context.Context) error {
+	var errs []error
+	for _, e := range l.endpoints {
+		if err := e.probe(ctx); err != nil {
+			e.markDown(time.Now(), l.config().EndpointRetryInterval)
+			errs = append(errs, err)
+			continue
+		}
+		e.markUp()
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+//-----------------------------------------------------------------------------
+
+// HealthHandler returns a handler answering 200 when Fluentd is reachable
+// and 503 otherwise, for the readiness probes, e.g.
+// app.Get("/ready/logger", logger.HealthHandler())
+func (l *Logger) HealthHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(c.Context(), defaultPingTimeout)
+		defer cancel()
+		if err := l.Ping(ctx); err != nil {
+			return c.Status(fiber.StatusServiceUnavailable).SendString(err.Error())
+		}
+		return c.SendString("ok")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// healthCheck probes the Fluentd servers every interval until Close. The
+// clients themselves re-establish their connection on the next post after a
+// failure, so the probe only has to track reachability: endpoints found back
+// are used again right away
+func (l *Logger) healthCheck(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			for _, e := range l.endpoints {
+				if err := e.probe(ctx); err != nil {
+					e.markDown(time.Now(), l.config().EndpointRetryInterval)
+				} else {
+					e.markUp()
+				}
+			}
+			cancel()
+		}
+	}
+}
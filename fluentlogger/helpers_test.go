@@ -0,0 +1,119 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+//*****************************************************************************
+
+// testRecord is a record received by a testSink
+type testRecord struct {
+	tag    string
+	record map[string]interface{}
+}
+
+//-----------------------------------------------------------------------------
+
+// testSink keeps the records posted to it. Each post waits delay and then
+// fails with err, if set
+type testSink struct {
+	mu      sync.Mutex
+	delay   time.Duration
+	err     error
+	posts   int
+	records []testRecord
+}
+
+//-----------------------------------------------------------------------------
+
+// Post records a post and keeps the record unless the sink fails
+func (s *testSink) Post(tag string, t time.Time, message interface{}) error {
+	time.Sleep(s.delay)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.posts++
+	if s.err != nil {
+		return s.err
+	}
+	record, _ := cloneMessage(message).(map[string]interface{})
+	s.records = append(s.records, testRecord{tag: tag, record: record})
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// received returns the records kept so far
+func (s *testSink) received() []testRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]testRecord(nil), s.records...)
+}
+
+//-----------------------------------------------------------------------------
+
+// attempts returns the number of posts so far
+func (s *testSink) attempts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.posts
+}
+
+//-----------------------------------------------------------------------------
+
+// spooledLines returns the number of records in the spool files of dir
+func spooledLines(t *testing.T, dir string) int {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, spoolPrefix+"*"+spoolSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := 0
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // replayed meanwhile
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines += bytes.Count(data, []byte("\n"))
+	}
+	return lines
+}
+
+//-----------------------------------------------------------------------------
+
+// eventually fails the test unless cond holds within timeout
+func eventually(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,145 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//*****************************************************************************
+
+// the timeout of the HTTP client used when HTTPClient is not set
+const defaultHTTPTimeout = 10 * time.Second
+
+//-----------------------------------------------------------------------------
+
+// httpOutput posts records as JSON to the HTTP input of Fluentd (in_http)
+// or Fluent Bit, the tag being the path of the URL
+type httpOutput struct {
+	base    string // the URL without trailing slash
+	address string // host:port of the URL, for the health checks
+	client  *http.Client
+	gzip    bool
+	headers map[string]string
+	prefix  string // the TagPrefix of FluentConfig
+}
+
+//-----------------------------------------------------------------------------
+
+// httpEndpoint returns an endpoint posting to the HTTP input at rawURL
+func httpEndpoint(rawURL string, config LoggerConfig) (*endpoint, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported fluentd HTTP URL %q", rawURL)
+	}
+
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), map[string]string{"http": "80", "https": "443"}[u.Scheme])
+	}
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+
+	return &endpoint{http: &httpOutput{
+		base:    strings.TrimSuffix(u.String(), "/"),
+		address: address,
+		client:  client,
+		gzip:    config.HTTPGzip,
+		headers: config.HTTPHeaders,
+		prefix:  config.FluentConfig.TagPrefix,
+	}}, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// post sends entries as a JSON array in a single request. Both Fluentd and
+// Fluent Bit take the event time from the "time" field of each record, as
+// seconds since the epoch; messages which are not maps are sent as
+// {"time": ..., "record": message}. The request is canceled with ctx
+func (h *httpOutput) post(ctx context.Context, tag string, entries []queuedMessage) error {
+	if h.prefix != "" {
+		tag = h.prefix + "." + tag
+	}
+
+	records := make([]map[string]interface{}, len(entries))
+	for i, m := range entries {
+		t := float64(m.time.UnixNano()) / 1e9
+		if record, ok := m.message.(map[string]interface{}); ok {
+			records[i] = maps.Clone(record)
+			if _, ok := record["time"]; !ok {
+				records[i]["time"] = t
+			}
+		} else {
+			records[i] = map[string]interface{}{"time": t, "record": m.message}
+		}
+	}
+
+	var body bytes.Buffer
+	var w io.Writer = &body
+	var zw *gzip.Writer
+	if h.gzip {
+		zw = gzip.NewWriter(&body)
+		w = zw
+	}
+	if err := json.NewEncoder(w).Encode(records); err != nil {
+		return err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.base+"/"+url.PathEscape(tag), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for name, value := range h.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("fluentd HTTP input answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// bearerClaims decodes the claims of the bearer JWT of the request WITHOUT
+// verifying its signature: they are only fit for logging, never for
+// authorization. It returns nil when there is no decodable token
+func bearerClaims(c *fiber.Ctx) map[string]interface{} {
+	scheme, token, found := strings.Cut(strings.TrimSpace(c.Get(fiber.HeaderAuthorization)), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return nil
+	}
+
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil
+	}
+	return claims
+}
+
+//-----------------------------------------------------------------------------
+
+// jwtClaims returns the configured JWTClaims of the request
+func (l *Logger) jwtClaims(c *fiber.Ctx) map[string]interface{} {
+	config := l.config()
+	extract := config.ClaimsExtractor
+	if extract == nil {
+		extract = bearerClaims
+	}
+	claims := extract(c)
+	if len(claims) == 0 {
+		return nil
+	}
+
+	selected := make(map[string]interface{}, len(config.JWTClaims))
+	for _, name := range config.JWTClaims {
+		if v, ok := claims[name]; ok {
+			selected[name] = v
+		}
+	}
+	return selected
+}
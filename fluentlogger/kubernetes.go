@@ -0,0 +1,65 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"os"
+)
+
+//*****************************************************************************
+
+// the fields of KubernetesFields and the downward API environment variables
+// they are read from, in order of preference
+var kubernetesEnv = []struct {
+	field string
+	vars  []string
+}{
+	{"k8s_pod", []string{"POD_NAME", "K8S_POD_NAME", "MY_POD_NAME"}},
+	{"k8s_namespace", []string{"POD_NAMESPACE", "K8S_NAMESPACE", "MY_POD_NAMESPACE"}},
+	{"k8s_node", []string{"NODE_NAME", "K8S_NODE_NAME", "MY_NODE_NAME"}},
+	{"k8s_container", []string{"CONTAINER_NAME", "K8S_CONTAINER_NAME"}},
+}
+
+//-----------------------------------------------------------------------------
+
+// KubernetesFields returns the pod, namespace, node and container names
+// exposed to the container through downward API environment variables, e.g.
+//
+//	env:
+//	  - name: POD_NAME
+//	    valueFrom: {fieldRef: {fieldPath: metadata.name}}
+//
+// Outside of Kubernetes it returns an empty map. Inside, the pod name falls
+// back to the hostname, which Kubernetes sets to it
+func KubernetesFields() map[string]interface{} {
+	fields := make(map[string]interface{})
+	for _, entry := range kubernetesEnv {
+		for _, name := range entry.vars {
+			if value := os.Getenv(name); value != "" {
+				fields[entry.field] = value
+				break
+			}
+		}
+	}
+
+	if _, ok := fields["k8s_pod"]; !ok && os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		if hostname, err := os.Hostname(); err == nil {
+			fields["k8s_pod"] = hostname
+		}
+	}
+	return fields
+}
@@ -0,0 +1,101 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"context"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// Flush posts the records held by the middleware, such as the counts of
+// deduplicated panics and errors, without waiting for their windows to expire, and
+// waits until the async queue is drained or ctx is done
+func (l *Logger) Flush(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if l.panics != nil {
+		l.panics.flushAll()
+	}
+	if l.failures != nil {
+		l.failures.flushAll()
+	}
+	if l.queue != nil {
+		if err := l.drain(ctx); err != nil {
+			return err
+		}
+	}
+	if l.batches != nil {
+		l.batches.flushAll()
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// Close flushes the pending records, stops the background tasks and closes
+// the Fluentd clients, except one provided through NewWithClient. In async
+// mode the client drains its buffer before closing. Closing again only
+// flushes
+func (l *Logger) Close() error {
+	err := l.Flush(context.Background())
+	l.closeOnce.Do(func() {
+		close(l.stop)
+		if l.queue != nil {
+			l.stopWorkers()
+		}
+		if l.batches != nil {
+			l.batches.flushAll() // what the workers batched last
+		}
+		if l.spool != nil {
+			l.spool.close()
+		}
+		for _, e := range l.endpoints {
+			if cerr := e.close(); cerr != nil {
+				err = cerr
+			}
+		}
+	})
+	return err
+}
+
+//-----------------------------------------------------------------------------
+
+// ShutdownHook returns a function closing the logger, to be registered with
+// Fiber so pending events are drained before the process exits:
+//
+//	app.Hooks().OnShutdown(logger.ShutdownHook())
+func (l *Logger) ShutdownHook() func() error {
+	return l.Close
+}
+
+//-----------------------------------------------------------------------------
+
+// Register wires the logger into app in one call: it exposes HealthHandler
+// at HealthPath when set, before the middleware so the probes are not
+// logged, installs the middleware and closes the logger on shutdown. It is
+// to be called before the routes to log are added
+func (l *Logger) Register(app *fiber.App) {
+	if path := l.config().HealthPath; path != "" {
+		app.Get(path, l.HealthHandler())
+	}
+	app.Use(l.Logger())
+	app.Hooks().OnShutdown(l.ShutdownHook())
+}
@@ -0,0 +1,88 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// DBQueriesLocal is the conventional c.Locals key for the number of database
+// queries run by the request. Add it to CounterLocals to log it as "db_queries"
+const DBQueriesLocal = "db_queries"
+
+// SpawnedJobsLocal is the c.Locals key holding the []string of background
+// job IDs enqueued by the request
+const SpawnedJobsLocal = "fluentlogger.spawned_jobs"
+
+//-----------------------------------------------------------------------------
+
+// IncrementCounter adds one to the int counter stored in c.Locals(key)
+func IncrementCounter(c *fiber.Ctx, key string) {
+	n, _ := c.Locals(key).(int)
+	c.Locals(key, n+1)
+}
+
+//-----------------------------------------------------------------------------
+
+// addCounters copies the configured counters from c.Locals into the record.
+// Absent or non-integer values are omitted
+func (l *Logger) addCounters(c *fiber.Ctx, record map[string]interface{}) {
+	for _, key := range l.config().CounterLocals {
+		switch v := c.Locals(key).(type) {
+		case int, int32, int64, uint, uint32, uint64:
+			record[key] = v
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// addLocals copies the c.Locals values of keys into the record, under the
+// mapped field names
+func addLocals(c *fiber.Ctx, keys map[string]string, record map[string]interface{}) {
+	for key, field := range keys {
+		v := c.Locals(key)
+		if v == nil {
+			continue
+		}
+		if field == "" {
+			field = key
+		}
+		record[field] = v
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// AddSpawnedJob records the ID of a background job enqueued by the request
+func AddSpawnedJob(c *fiber.Ctx, id string) {
+	jobs, _ := c.Locals(SpawnedJobsLocal).([]string)
+	c.Locals(SpawnedJobsLocal, append(jobs, id))
+}
+
+//-----------------------------------------------------------------------------
+
+// spawnedJobs returns a copy of the job IDs stored in c.Locals
+func spawnedJobs(c *fiber.Ctx) []string {
+	jobs, _ := c.Locals(SpawnedJobsLocal).([]string)
+	if len(jobs) == 0 {
+		return nil
+	}
+	return append([]string(nil), jobs...)
+}
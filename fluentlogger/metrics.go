@@ -0,0 +1,173 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// the upper bounds, in seconds, of the post latency histogram buckets
+var postLatencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+//-----------------------------------------------------------------------------
+
+// Stats is a snapshot of the internal metrics of the middleware. A post
+// left running at PostTimeout counts as abandoned, and later as posted or
+// failed once it ends
+type Stats struct {
+	Posted      uint64    // records accepted by Fluentd, one per record of a batch
+	Failed      uint64    // posts (single records or batches) Fluentd did not accept
+	Abandoned   uint64    // posts left running at PostTimeout
+	Dropped     uint64    // records discarded by the async queue or the timed out posts
+	QueueDepth  int       // records waiting in the async queue
+	PostLatency Histogram // duration of the posts to Fluentd, up to PostTimeout
+}
+
+// Histogram holds cumulative bucket counts, as Prometheus does
+type Histogram struct {
+	Buckets []float64 // upper bounds in seconds
+	Counts  []uint64  // observations less than or equal to each bound
+	Count   uint64    // all the observations
+	Sum     float64   // sum of the observations in seconds
+}
+
+//-----------------------------------------------------------------------------
+
+// metrics are the internal counters, updated atomically
+type metrics struct {
+	posted    atomic.Uint64
+	failed    atomic.Uint64
+	abandoned atomic.Uint64
+	buckets   [13]atomic.Uint64 // one per bound plus +Inf, not cumulative
+	sumNs     atomic.Uint64
+}
+
+//-----------------------------------------------------------------------------
+
+// observe accounts for a post of records to Fluentd, which took d. The
+// posts left running are settled when they end, the dropped ones are
+// accounted for in Logger.dropped
+func (m *metrics) observe(d time.Duration, records int, err error) {
+	switch {
+	case errors.Is(err, errPostAbandoned):
+		m.abandoned.Add(1)
+	case errors.Is(err, errPostDropped):
+	default:
+		m.settle(records, err)
+	}
+
+	seconds := d.Seconds()
+	i := 0
+	for i < len(postLatencyBuckets) && seconds > postLatencyBuckets[i] {
+		i++
+	}
+	m.buckets[i].Add(1)
+	m.sumNs.Add(uint64(d))
+}
+
+//-----------------------------------------------------------------------------
+
+// settle accounts for the outcome of a post of records
+func (m *metrics) settle(records int, err error) {
+	if err == nil {
+		m.posted.Add(uint64(records))
+	} else {
+		m.failed.Add(1)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// Stats returns the current internal metrics
+func (l *Logger) Stats() Stats {
+	stats := Stats{
+		Posted:     l.metrics.posted.Load(),
+		Failed:     l.metrics.failed.Load(),
+		Abandoned:  l.metrics.abandoned.Load(),
+		Dropped:    l.dropped.Load(),
+		QueueDepth: len(l.queue),
+		PostLatency: Histogram{
+			Buckets: postLatencyBuckets,
+			Counts:  make([]uint64, len(postLatencyBuckets)),
+			Sum:     time.Duration(l.metrics.sumNs.Load()).Seconds(),
+		},
+	}
+
+	var cumulative uint64
+	for i := range l.metrics.buckets {
+		cumulative += l.metrics.buckets[i].Load()
+		if i < len(postLatencyBuckets) {
+			stats.PostLatency.Counts[i] = cumulative
+		}
+	}
+	stats.PostLatency.Count = cumulative
+
+	return stats
+}
+
+//-----------------------------------------------------------------------------
+
+// WritePrometheus writes the internal metrics in the Prometheus text
+// exposition format. No prometheus.Collector is provided, to keep
+// client_golang out of the dependencies: serve this output on its own, or
+// build the collector from Stats
+func (l *Logger) WritePrometheus(w io.Writer) error {
+	stats := l.Stats()
+	var b bytes.Buffer
+
+	writeMetric := func(name, kind, help string, value interface{}) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+	}
+	writeMetric("fluentlogger_events_posted_total", "counter", "Records accepted by Fluentd.", stats.Posted)
+	writeMetric("fluentlogger_post_failures_total", "counter", "Posts Fluentd did not accept.", stats.Failed)
+	writeMetric("fluentlogger_posts_abandoned_total", "counter", "Posts left running at the post timeout.", stats.Abandoned)
+	writeMetric("fluentlogger_events_dropped_total", "counter", "Records discarded by the async queue or the timed out posts.", stats.Dropped)
+	writeMetric("fluentlogger_queue_depth", "gauge", "Records waiting in the async queue.", stats.QueueDepth)
+
+	const histogram = "fluentlogger_post_duration_seconds"
+	fmt.Fprintf(&b, "# HELP %s Duration of the posts to Fluentd.\n# TYPE %s histogram\n", histogram, histogram)
+	for i, bound := range stats.PostLatency.Buckets {
+		fmt.Fprintf(&b, "%s_bucket{le=\"%s\"} %d\n", histogram, strconv.FormatFloat(bound, 'g', -1, 64), stats.PostLatency.Counts[i])
+	}
+	fmt.Fprintf(&b, "%s_bucket{le=\"+Inf\"} %d\n", histogram, stats.PostLatency.Count)
+	fmt.Fprintf(&b, "%s_sum %s\n", histogram, strconv.FormatFloat(stats.PostLatency.Sum, 'g', -1, 64))
+	fmt.Fprintf(&b, "%s_count %d\n", histogram, stats.PostLatency.Count)
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+//-----------------------------------------------------------------------------
+
+// MetricsHandler returns a handler exposing the internal metrics to
+// Prometheus scrapers, e.g. app.Get("/metrics/logger", logger.MetricsHandler())
+func (l *Logger) MetricsHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+		return l.WritePrometheus(c)
+	}
+}
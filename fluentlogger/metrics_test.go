@@ -0,0 +1,69 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"testing"
+	"time"
+)
+
+//*****************************************************************************
+
+// TestStatsBatch checks that a batch counts one posted record per entry
+func TestStatsBatch(t *testing.T) {
+	l, err := NewWithSink(&testSink{}, LoggerConfig{Enabled: true, Tag: "app", BatchSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := l.emit("app.test", map[string]interface{}{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := l.Stats(); stats.Posted != 3 || stats.Failed != 0 {
+		t.Errorf("Posted %d, Failed %d, want 3 and 0", stats.Posted, stats.Failed)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// TestStatsAbandoned checks that a post left running at PostTimeout counts
+// as abandoned, then as posted once it succeeds
+func TestStatsAbandoned(t *testing.T) {
+	l, err := NewWithSink(&testSink{delay: 50 * time.Millisecond}, LoggerConfig{
+		Enabled:     true,
+		Tag:         "app",
+		PostTimeout: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if err := l.emit("app.test", map[string]interface{}{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if stats := l.Stats(); stats.Abandoned != 1 || stats.Posted != 0 || stats.Failed != 0 {
+		t.Errorf("Abandoned %d, Posted %d, Failed %d, want 1, 0 and 0", stats.Abandoned, stats.Posted, stats.Failed)
+	}
+	eventually(t, time.Second, func() bool { return l.Stats().Posted == 1 })
+	if failed := l.Stats().Failed; failed != 0 {
+		t.Errorf("Failed %d, want 0", failed)
+	}
+}
@@ -0,0 +1,261 @@
+// Package otelsink provides a sink emitting the middleware records through
+// the OpenTelemetry logs API, so they can go to an OTel collector over OTLP
+// with the same fields as the Fluentd records. It is a module of its own, so
+// the middleware itself does not depend on OpenTelemetry.
+package otelsink
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/global"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//*****************************************************************************
+
+// the instrumentation scope of the records, unless Config.Name is set
+const defaultName = "github.com/rgglez/gofiber-fluent-middleware"
+
+//-----------------------------------------------------------------------------
+
+type Config struct {
+	// Provider creates the OTel logger, the global provider by default. It
+	// usually is an sdk/log LoggerProvider with an OTLP exporter
+	Provider log.LoggerProvider
+	Name     string // the instrumentation scope name, defaultName by default
+}
+
+//-----------------------------------------------------------------------------
+
+// Sink emits records as OTel log records: the tag becomes the event name
+// and the body, the fields become attributes, "trace_id" and "span_id"
+// link the record to its trace and the severity comes from "level" or else
+// from "status"
+type Sink struct {
+	logger log.Logger
+}
+
+//-----------------------------------------------------------------------------
+
+// New returns a sink emitting through the logger of config.Provider
+func New(config Config) *Sink {
+	if config.Provider == nil {
+		config.Provider = global.GetLoggerProvider()
+	}
+	if config.Name == "" {
+		config.Name = defaultName
+	}
+	return &Sink{logger: config.Provider.Logger(config.Name)}
+}
+
+//-----------------------------------------------------------------------------
+
+// Post emits a record. The provider exports it asynchronously, after
+// copying the values, so the message is not kept
+func (s *Sink) Post(tag string, t time.Time, message interface{}) error {
+	var record log.Record
+	record.SetEventName(tag)
+	record.SetTimestamp(t)
+	record.SetObservedTimestamp(time.Now())
+	record.SetBody(log.StringValue(tag))
+
+	ctx := context.Background()
+	fields, ok := message.(map[string]interface{})
+	if !ok {
+		// e.g. a compact array
+		record.SetBody(value(message))
+		s.logger.Emit(ctx, record)
+		return nil
+	}
+
+	severity, text := severityOf(fields)
+	record.SetSeverity(severity)
+	record.SetSeverityText(text)
+	if sc, ok := spanContext(fields); ok {
+		ctx = trace.ContextWithSpanContext(ctx, sc)
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]log.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, log.KeyValue{Key: k, Value: value(fields[k])})
+	}
+	record.AddAttributes(attrs...)
+
+	s.logger.Emit(ctx, record)
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// severityOf maps the "level" field (slog and event records) or else the
+// HTTP status of an access record to an OTel severity
+func severityOf(fields map[string]interface{}) (log.Severity, string) {
+	if level, ok := fields["level"].(string); ok {
+		switch strings.ToUpper(level) {
+		case "DEBUG":
+			return log.SeverityDebug, "DEBUG"
+		case "WARN", "WARNING":
+			return log.SeverityWarn, "WARN"
+		case "ERROR":
+			return log.SeverityError, "ERROR"
+		case "FATAL":
+			return log.SeverityFatal, "FATAL"
+		}
+		return log.SeverityInfo, "INFO"
+	}
+
+	status, ok := number(fields["status"])
+	switch {
+	case !ok:
+		return log.SeverityInfo, "INFO"
+	case status >= 500:
+		return log.SeverityError, "ERROR"
+	case status >= 400:
+		return log.SeverityWarn, "WARN"
+	}
+	return log.SeverityInfo, "INFO"
+}
+
+//-----------------------------------------------------------------------------
+
+// spanContext builds the span context of the "trace_id" and "span_id"
+// fields (hex, as logged with LogTraceContext)
+func spanContext(fields map[string]interface{}) (trace.SpanContext, bool) {
+	traceID, _ := fields["trace_id"].(string)
+	spanID, _ := fields["span_id"].(string)
+	var config trace.SpanContextConfig
+	b, err := hex.DecodeString(traceID)
+	if err != nil || len(b) != len(config.TraceID) {
+		return trace.SpanContext{}, false
+	}
+	copy(config.TraceID[:], b)
+	if b, err := hex.DecodeString(spanID); err == nil && len(b) == len(config.SpanID) {
+		copy(config.SpanID[:], b)
+	}
+	sc := trace.NewSpanContext(config)
+	return sc, sc.HasTraceID()
+}
+
+//-----------------------------------------------------------------------------
+
+// number returns v as an int64 when it holds a number
+func number(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case int32:
+		return int64(n), true
+	case float64:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+//-----------------------------------------------------------------------------
+
+// value converts a record value to an OTel log value. The types without an
+// OTel counterpart are sent as their JSON encoding
+func value(v interface{}) log.Value {
+	switch v := v.(type) {
+	case nil:
+		return log.Value{}
+	case string:
+		return log.StringValue(v)
+	case bool:
+		return log.BoolValue(v)
+	case int:
+		return log.IntValue(v)
+	case int8:
+		return log.Int64Value(int64(v))
+	case int16:
+		return log.Int64Value(int64(v))
+	case int32:
+		return log.Int64Value(int64(v))
+	case int64:
+		return log.Int64Value(v)
+	case uint:
+		return log.Int64Value(int64(v))
+	case uint8:
+		return log.Int64Value(int64(v))
+	case uint16:
+		return log.Int64Value(int64(v))
+	case uint32:
+		return log.Int64Value(int64(v))
+	case uint64:
+		return log.Int64Value(int64(v))
+	case float32:
+		return log.Float64Value(float64(v))
+	case float64:
+		return log.Float64Value(v)
+	case []byte:
+		return log.BytesValue(v)
+	case time.Time:
+		return log.StringValue(v.Format(time.RFC3339Nano))
+	case time.Duration:
+		return log.Int64Value(v.Milliseconds())
+	case error:
+		return log.StringValue(v.Error())
+	case fmt.Stringer:
+		return log.StringValue(v.String())
+	case map[string]interface{}:
+		kvs := make([]log.KeyValue, 0, len(v))
+		for k, e := range v {
+			kvs = append(kvs, log.KeyValue{Key: k, Value: value(e)})
+		}
+		return log.MapValue(kvs...)
+	case map[string]string:
+		kvs := make([]log.KeyValue, 0, len(v))
+		for k, e := range v {
+			kvs = append(kvs, log.String(k, e))
+		}
+		return log.MapValue(kvs...)
+	case []interface{}:
+		vs := make([]log.Value, len(v))
+		for i, e := range v {
+			vs[i] = value(e)
+		}
+		return log.SliceValue(vs...)
+	case []string:
+		vs := make([]log.Value, len(v))
+		for i, e := range v {
+			vs[i] = log.StringValue(e)
+		}
+		return log.SliceValue(vs...)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return log.StringValue(fmt.Sprint(v))
+	}
+	return log.StringValue(string(data))
+}
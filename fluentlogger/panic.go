@@ -0,0 +1,151 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// the c.Locals key flagging the requests whose panic was recovered
+const panickedLocal = "fluentlogger.panicked"
+
+//-----------------------------------------------------------------------------
+
+// PanicLogger recovers the panics of the next handlers and logs them to
+// Fluentd with the panic value, its type and the stack trace of the
+// panicking goroutine. The panic is then raised again for an outer recover
+// middleware, unless PanicRecover is set. The access record of a recovered
+// panic carries "panic": true, unlike the 500s returned by the handlers
+func (l *Logger) PanicLogger() fiber.Handler {
+	return func(c *fiber.Ctx) (err error) {
+		config := l.config()
+		if l.noop || l.skip(c) {
+			return c.Next()
+		}
+		if config.RequestID {
+			l.ensureRequestID(c)
+		}
+		l.echoCorrelationHeaders(c)
+
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+
+			l.logPanic(c, recovered)
+
+			if !config.PanicRecover {
+				panic(recovered)
+			}
+			err = config.PanicHandler(c, recovered)
+		}()
+
+		return c.Next() // Process the request
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// logPanic sends the record of a recovered panic. It must be called from the
+// deferred function, so the panicking frames are still on the stack
+func (l *Logger) logPanic(c *fiber.Ctx, recovered interface{}) {
+	message := fmt.Sprint(recovered)
+
+	// Log data to Fluentd
+	logData := map[string]interface{}{
+		"method":     c.Method(),
+		"path":       c.Path(),
+		"client_ip":  l.clientIP(c),
+		"user_agent": c.Get("User-Agent"),
+		"error":      message,
+		"panic":      true,
+		"panic_type": fmt.Sprintf("%T", recovered),
+	}
+	c.Locals(panickedLocal, true)
+	l.addCommonFields(c, logData)
+	l.enrich(c, logData)
+	l.redact(logData)
+
+	tag := l.requestTag(c) + ".panic"
+	var key uint64
+	if l.panics != nil || l.stacks != nil {
+		key = panicKey(panicLocation(), message)
+	}
+	if l.panics != nil {
+		if !l.panics.add(key, tag, logData) {
+			return
+		}
+		logData["panic_count"] = 1
+	}
+
+	if capture, repeats := l.captureStack(key); capture {
+		logData["stacktrace"] = panicStack()
+	} else {
+		logData["panic_repeats"] = repeats
+	}
+
+	l.stringifyNumbers(logData)
+
+	// Send to Fluentd
+	l.send(tag, logData)
+}
+
+//-----------------------------------------------------------------------------
+
+// panicStack returns the stack trace of the panicking goroutine from the
+// frame which panicked, without the frames of the recovery itself
+func panicStack() string {
+	stack := string(debug.Stack())
+	header, frames, _ := strings.Cut(stack, "\n")
+	if i := strings.Index(frames, "\npanic("); i >= 0 {
+		frames = frames[i+1:]
+	}
+	return header + "\n" + frames
+}
+
+//-----------------------------------------------------------------------------
+
+// panicLocation returns the "file:line" where the current panic was raised:
+// the first frame below runtime.gopanic outside the runtime. This is much
+// cheaper than capturing the whole stack
+func panicLocation() string {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(1, pcs)])
+
+	panicking := false
+	for {
+		frame, more := frames.Next()
+		if panicking && !strings.HasPrefix(frame.Function, "runtime.") {
+			return frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+		if frame.Function == "runtime.gopanic" {
+			panicking = true
+		}
+		if !more {
+			return ""
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"sync"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// recordPool holds the maps of the access records, sized for the usual set
+// of fields so they rarely grow
+var recordPool = sync.Pool{
+	New: func() interface{} {
+		return make(map[string]interface{}, 32)
+	},
+}
+
+// poolRecords turns the pooling off when false, for the benchmarks
+var poolRecords = true
+
+//-----------------------------------------------------------------------------
+
+// getRecord returns an empty record from the pool
+func getRecord() map[string]interface{} {
+	if !poolRecords {
+		return make(map[string]interface{}, 32)
+	}
+	return recordPool.Get().(map[string]interface{})
+}
+
+//-----------------------------------------------------------------------------
+
+// putRecord empties a record and returns it to the pool. The record must
+// not be referenced anymore: the async queue, and the spool and fallback
+// writers, keep copies or encodings of the records they receive
+func putRecord(record map[string]interface{}) {
+	if !poolRecords {
+		return
+	}
+	clear(record)
+	recordPool.Put(record)
+}
+
+//-----------------------------------------------------------------------------
+
+// responseSize returns the size of the response body without reading a
+// body stream, whose size is its Content-Length or -1 when it is unknown
+func responseSize(c *fiber.Ctx) int {
+	if c.Response().IsBodyStream() {
+		return c.Response().Header.ContentLength()
+	}
+	return len(c.Response().Body())
+}
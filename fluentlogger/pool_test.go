@@ -0,0 +1,69 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"testing"
+
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+//*****************************************************************************
+
+// BenchmarkLogger runs the middleware against a sink discarding the records,
+// with and without the record pool:
+//
+//	go test -run '^$' -bench BenchmarkLogger ./fluentlogger
+func BenchmarkLogger(b *testing.B) {
+	for _, bench := range []struct {
+		name string
+		pool bool
+	}{
+		{"pooled", true},
+		{"unpooled", false},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			poolRecords = bench.pool
+			defer func() { poolRecords = true }()
+
+			l, err := NewWithSink(discardSink{}, LoggerConfig{Enabled: true, Tag: "bench"})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer l.Close()
+
+			app := fiber.New()
+			app.Use(l.Logger())
+			app.Get("/", func(c *fiber.Ctx) error {
+				return c.SendString("ok")
+			})
+			handler := app.Handler()
+
+			var ctx fasthttp.RequestCtx
+			ctx.Request.SetRequestURI("/")
+			ctx.Request.Header.SetMethod(fiber.MethodGet)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				handler(&ctx)
+				ctx.Response.Reset()
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fluent/fluent-logger-golang/fluent"
+	"github.com/ztrue/tracerr"
+)
+
+//*****************************************************************************
+
+// send emits a message, printing the post errors since there is nobody to
+// return them to
+func (l *Logger) send(tag string, message interface{}) {
+	l.sendAt(tag, l.now(), message)
+}
+
+//-----------------------------------------------------------------------------
+
+// sendAt is send with an explicit event time
+func (l *Logger) sendAt(tag string, t time.Time, message interface{}) {
+	if err := l.emitAt(tag, t, message); err != nil {
+		tracerr.PrintSource(err)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// emit posts a message now or, in async or batch mode, queues it. Nothing is
+// posted while the logging is disabled
+func (l *Logger) emit(tag string, message interface{}) error {
+	return l.emitAt(tag, l.now(), message)
+}
+
+//-----------------------------------------------------------------------------
+
+// emitAt is emit with an explicit event time
+func (l *Logger) emitAt(tag string, t time.Time, message interface{}) error {
+	return l.emitSealed(tag, t, message, nil)
+}
+
+//-----------------------------------------------------------------------------
+
+// emitSealed is emitAt sealing the record in its final form in chain, if
+// given. The chain only moves on when the record is not dropped
+func (l *Logger) emitSealed(tag string, t time.Time, message interface{}, chain *auditChain) error {
+	if l.disabled.Load() {
+		return nil
+	}
+	if record, ok := message.(map[string]interface{}); ok {
+		l.addTimestamp(record, t)
+	}
+	message = l.serialize(message)
+	var hash string
+	if chain != nil {
+		chain.mu.Lock()
+		defer chain.mu.Unlock()
+		record, ok := message.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("audit record serialized as %T", message)
+		}
+		var err error
+		if hash, err = chain.seal(record); err != nil {
+			return err
+		}
+	}
+
+	if l.queue != nil {
+		if l.enqueue(queuedMessage{tag: tag, time: t, message: cloneMessage(message)}) && chain != nil {
+			chain.commit(hash)
+		}
+		return nil
+	}
+	if l.batches != nil {
+		l.batches.add(queuedMessage{tag: tag, time: t, message: cloneMessage(message)})
+		if chain != nil {
+			chain.commit(hash)
+		}
+		return nil
+	}
+	err := l.post(tag, t, message)
+	if chain != nil && !errors.Is(err, errPostDropped) {
+		chain.commit(hash)
+	}
+	return err
+}
+
+//-----------------------------------------------------------------------------
+
+// post sends a message to Fluentd and to the configured sinks. A post not
+// done within PostTimeout, retries included, is rescued like a failed one,
+// once it ends if it was left running
+func (l *Logger) post(tag string, now time.Time, message interface{}) error {
+	ctx, cancel := l.postContext()
+	defer cancel()
+	fluentMessage := message
+	if ctx.Done() != nil {
+		// the post may outlive the call, and message be reused by the caller
+		fluentMessage = cloneMessage(message)
+	}
+	late := func(err error) {
+		l.metrics.settle(1, err)
+		if err != nil {
+			if err = l.rescue(tag, now, fluentMessage, err); err != nil {
+				tracerr.PrintSource(err)
+			}
+		}
+	}
+
+	start := time.Now()
+	err := l.retry(ctx, func() error { return l.postFluent(ctx, tag, now, fluentMessage) }, late)
+	l.metrics.observe(time.Since(start), 1, err)
+	switch {
+	case errors.Is(err, errPostAbandoned):
+		err = nil // rescued by late if it fails
+	case errors.Is(err, errPostDropped):
+		l.dropped.Add(1)
+	case err != nil:
+		err = l.rescue(tag, now, message, err)
+	}
+
+	return errors.Join(err, l.postSinks(tag, now, message))
+}
+
+//-----------------------------------------------------------------------------
+
+// postContext returns the context bounding a post by PostTimeout, if set
+func (l *Logger) postContext() (context.Context, context.CancelFunc) {
+	if timeout := l.config().PostTimeout; timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.Background(), func() {}
+}
+
+//-----------------------------------------------------------------------------
+
+// rescue keeps a message Fluentd did not take, failing with err, in the
+// spool or else in the FallbackWriter. It returns the errors left, nil once
+// the message is safe
+func (l *Logger) rescue(tag string, now time.Time, message interface{}, err error) error {
+	if l.spool != nil {
+		serr := l.spool.append(tag, now, message)
+		if serr == nil {
+			return nil
+		}
+		err = errors.Join(err, serr)
+	}
+	if l.config().FallbackWriter != nil {
+		ferr := l.writeFallback(tag, now, message)
+		if ferr == nil {
+			return nil
+		}
+		err = errors.Join(err, ferr)
+	}
+	return err
+}
+
+//-----------------------------------------------------------------------------
+
+// postSinks sends a message to the configured sinks
+func (l *Logger) postSinks(tag string, now time.Time, message interface{}) error {
+	var errs []error
+	for _, sink := range l.config().Sinks {
+		errs = append(errs, sink.Post(tag, now, message))
+	}
+	return errors.Join(errs...)
+}
+
+//-----------------------------------------------------------------------------
+
+// postFluent sends a message to the first endpoint accepting it, in the
+// order given by the balance policy
+func (l *Logger) postFluent(ctx context.Context, tag string, t time.Time, message interface{}) error {
+	var errs []error
+	for _, e := range l.endpointOrder() {
+		var err error
+		switch {
+		case e.client != nil:
+			err = postClient(e.client, tag, t, message)
+		case e.http != nil:
+			err = e.http.post(ctx, tag, []queuedMessage{{tag: tag, time: t, message: message}})
+		case e.sink != nil:
+			err = e.sink.Post(tag, t, message)
+		default:
+			err = e.writeMessage(ctx, tag, t, message, l.config().AckTimeout)
+		}
+		if err == nil {
+			e.markUp()
+			return nil
+		}
+		e.markDown(time.Now(), l.config().EndpointRetryInterval)
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+//-----------------------------------------------------------------------------
+
+// postClient sends a message through a Fluentd client. Maps go through the
+// regular PostWithTime, any other message (e.g. a compact array) is encoded
+// as is
+func postClient(client *fluent.Fluent, tag string, t time.Time, message interface{}) error {
+	if record, ok := message.(map[string]interface{}); ok {
+		return client.PostWithTime(tag, t, record)
+	}
+
+	// EncodeAndPostData skips the prefix handling done by PostWithTime
+	if client.TagPrefix != "" {
+		tag = client.TagPrefix + "." + tag
+	}
+	return client.EncodeAndPostData(tag, t, message)
+}
@@ -0,0 +1,128 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// QueryMode tells how the query string is logged
+type QueryMode int
+
+const (
+	QueryOff    QueryMode = iota // the query string is not logged
+	QueryRaw                     // logged as a string, e.g. "a=1&token=[REDACTED]"
+	QueryParsed                  // logged as a map, repeated parameters as lists
+)
+
+// DefaultRedactQueryParams are the query parameters redacted when
+// RedactQueryParams is nil
+var DefaultRedactQueryParams = []string{
+	"token",
+	"access_token",
+	"api_key",
+	"apikey",
+	"password",
+	"secret",
+}
+
+//-----------------------------------------------------------------------------
+
+// queryKeys returns the sorted, deduplicated names of the query parameters,
+// leaving their values out
+func queryKeys(c *fiber.Ctx) []string {
+	var keys []string
+	c.Context().QueryArgs().VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+//-----------------------------------------------------------------------------
+
+// query returns the query string of the request per LogQuery, or nil when
+// it is not logged or empty
+func (l *Logger) query(c *fiber.Ctx) interface{} {
+	config := l.config()
+	args := c.Context().QueryArgs()
+	if config.LogQuery == QueryOff || args.Len() == 0 {
+		return nil
+	}
+
+	if config.LogQuery == QueryRaw {
+		return l.rawQuery(c)
+	}
+
+	params := make(map[string]interface{}, args.Len())
+	args.VisitAll(func(key, value []byte) {
+		name, v := string(key), string(value)
+		if l.redactedQueryParam(name) {
+			v = Redacted
+		}
+		switch prev := params[name].(type) {
+		case nil:
+			params[name] = v
+		case string:
+			params[name] = []string{prev, v}
+		case []string:
+			params[name] = append(prev, v)
+		}
+	})
+	return params
+}
+
+//-----------------------------------------------------------------------------
+
+// rawQuery returns the query string of the request, e.g.
+// "a=1&token=[REDACTED]", with the values of RedactQueryParams and
+// RedactKeys redacted
+func (l *Logger) rawQuery(c *fiber.Ctx) string {
+	var b strings.Builder
+	c.Context().QueryArgs().VisitAll(func(key, value []byte) {
+		if b.Len() > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(url.QueryEscape(string(key)))
+		b.WriteByte('=')
+		if l.redactedQueryParam(string(key)) || l.redactedKey(string(key)) {
+			b.WriteString(Redacted)
+		} else {
+			b.WriteString(url.QueryEscape(string(value)))
+		}
+	})
+	return b.String()
+}
+
+//-----------------------------------------------------------------------------
+
+// redactedQueryParam tells whether the value of the query parameter must be
+// redacted
+func (l *Logger) redactedQueryParam(name string) bool {
+	for _, redacted := range l.config().RedactQueryParams {
+		if strings.EqualFold(name, redacted) {
+			return true
+		}
+	}
+	return false
+}
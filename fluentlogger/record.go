@@ -0,0 +1,279 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// addCommonFields adds the optional fields shared by every stream
+func (l *Logger) addCommonFields(c *fiber.Ctx, record map[string]interface{}) {
+	config := l.config()
+	if config.GenerateID {
+		record["log_id"] = config.IDGenerator()
+	}
+	if config.RequestID {
+		if id := RequestID(c); id != "" {
+			record["request_id"] = id
+		}
+	}
+	l.addCorrelationFields(c, record)
+	if config.LogHost {
+		record["host"] = c.Hostname()
+	}
+	if config.LogTraceContext {
+		l.addTraceFields(c, record)
+	}
+	if config.IncludeUptime {
+		record["uptime_seconds"] = int64(time.Since(l.started).Seconds())
+	}
+	addLocals(c, config.LocalsKeys, record)
+	l.addGlobalFields(record)
+}
+
+//-----------------------------------------------------------------------------
+
+// enrich runs the configured enrichers on the record
+func (l *Logger) enrich(c *fiber.Ctx, record map[string]interface{}) {
+	for _, enricher := range l.config().Enrichers {
+		enricher(c, record)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// stringifyNumbers replaces the integer values of the configured fields with
+// their decimal representation
+func (l *Logger) stringifyNumbers(record map[string]interface{}) {
+	for _, name := range l.config().StringifyNumbers {
+		switch v := record[name].(type) {
+		case int:
+			record[name] = strconv.Itoa(v)
+		case int32:
+			record[name] = strconv.FormatInt(int64(v), 10)
+		case int64:
+			record[name] = strconv.FormatInt(v, 10)
+		case uint:
+			record[name] = strconv.FormatUint(uint64(v), 10)
+		case uint32:
+			record[name] = strconv.FormatUint(uint64(v), 10)
+		case uint64:
+			record[name] = strconv.FormatUint(v, 10)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// isStatic tells whether the request was routed to one of the configured
+// static prefixes, either by its matched route or by its path
+func (l *Logger) isStatic(c *fiber.Ctx) bool {
+	route := c.Route().Path
+	path := c.Path()
+	for _, prefix := range l.config().StaticPrefixes {
+		if route == prefix || path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+//-----------------------------------------------------------------------------
+
+// isWebSocketUpgrade tells whether the request asks for a WebSocket upgrade
+func isWebSocketUpgrade(c *fiber.Ctx) bool {
+	return c.Request().Header.ConnectionUpgrade() &&
+		strings.EqualFold(c.Get(fiber.HeaderUpgrade), "websocket")
+}
+
+//-----------------------------------------------------------------------------
+
+// addResponseHeaderFields copies the configured response headers into the
+// record under their mapped field names
+func (l *Logger) addResponseHeaderFields(c *fiber.Ctx, record map[string]interface{}) {
+	for header, field := range l.config().ResponseHeaderFields {
+		if value := c.Response().Header.Peek(header); len(value) > 0 {
+			record[field] = string(value)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// compact returns the values of the configured compact fields in order;
+// missing fields are nil
+func (l *Logger) compact(record map[string]interface{}) []interface{} {
+	config := l.config()
+	values := make([]interface{}, len(config.CompactFields))
+	for i, name := range config.CompactFields {
+		values[i] = record[name]
+	}
+	return values
+}
+
+//-----------------------------------------------------------------------------
+
+// authScheme returns the scheme token of an Authorization header value, e.g.
+// "Bearer". Values without a scheme are reported as "unknown" so a bare
+// credential is never logged
+func authScheme(authorization string) string {
+	authorization = strings.TrimSpace(authorization)
+	if authorization == "" {
+		return "none"
+	}
+	scheme, _, found := strings.Cut(authorization, " ")
+	if !found {
+		return "unknown"
+	}
+	return scheme
+}
+
+//-----------------------------------------------------------------------------
+
+// cloneRecord returns a copy of the record which is safe to keep after the
+// request ends: Fiber strings point into buffers that are reused
+func cloneRecord(record map[string]interface{}) map[string]interface{} {
+	clone := make(map[string]interface{}, len(record))
+	for k, v := range record {
+		switch v := v.(type) {
+		case string:
+			clone[k] = strings.Clone(v)
+		default:
+			clone[k] = cloneMessage(v)
+		}
+	}
+	return clone
+}
+
+//-----------------------------------------------------------------------------
+
+// cloneMessage is cloneRecord for any message: records, compact arrays and
+// their values
+func cloneMessage(message interface{}) interface{} {
+	switch v := message.(type) {
+	case string:
+		return strings.Clone(v)
+	case map[string]interface{}:
+		return cloneRecord(v)
+	case []interface{}:
+		clone := make([]interface{}, len(v))
+		for i := range v {
+			clone[i] = cloneMessage(v[i])
+		}
+		return clone
+	default:
+		return v
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// roundLatency rounds a float latency to LatencyPrecision decimal places
+func (l *Logger) roundLatency(latency float64) float64 {
+	config := l.config()
+	if config.LatencyPrecision <= 0 {
+		return latency
+	}
+	scale := math.Pow10(config.LatencyPrecision)
+	return math.Round(latency*scale) / scale
+}
+
+//-----------------------------------------------------------------------------
+
+// DefaultStableFields returns the optional access fields with their zero
+// values, used by StableSchema when no StableFields are given, with the
+// "error" zero then matching the ErrorFormatter
+func DefaultStableFields() map[string]interface{} {
+	return map[string]interface{}{
+		"log_id":            "",
+		"host":              "",
+		"static":            false,
+		"replay":            false,
+		"auth_scheme":       "",
+		"request_body_hash": "",
+		"latency_s":         -1.0,
+		"error":             map[string]interface{}{},
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// errorZero returns the stable zero of the "error" field for the values
+// made by formatter: "" for strings, an empty object for maps and nil for
+// any other type
+func errorZero(formatter func(error) interface{}) interface{} {
+	switch formatter(errors.New("")).(type) {
+	case string:
+		return ""
+	case map[string]interface{}:
+		return map[string]interface{}{}
+	default:
+		return nil
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// stabilize fills the stable fields missing from the record. The zero maps
+// and slices (e.g. the "error" object) are copied, so no record shares them
+func (l *Logger) stabilize(record map[string]interface{}) {
+	for name, zero := range l.config().StableFields {
+		if _, ok := record[name]; !ok {
+			record[name] = cloneMessage(zero)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// selectFields applies the Fields allowlist and the FieldMap renames
+func (l *Logger) selectFields(record map[string]interface{}) map[string]interface{} {
+	config := l.config()
+	if len(config.Fields) == 0 && len(config.FieldMap) == 0 {
+		return record
+	}
+
+	if len(config.Fields) > 0 {
+		selected := make(map[string]interface{}, len(config.Fields))
+		for _, name := range config.Fields {
+			if value, ok := record[name]; ok {
+				selected[name] = value
+			}
+		}
+		record = selected
+	}
+
+	if len(config.FieldMap) == 0 {
+		return record
+	}
+	renamed := make(map[string]interface{}, len(record))
+	for name, value := range record {
+		if to, ok := config.FieldMap[name]; ok {
+			name = to
+		}
+		renamed[name] = value
+	}
+	return renamed
+}
@@ -0,0 +1,87 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// TestStableErrorType checks that with StableSchema the "error" field keeps
+// the type of the ErrorFormatter values, whether the request failed or not
+func TestStableErrorType(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		formatter func(error) interface{}
+		str       bool // whether the values are strings rather than objects
+	}{
+		{"default", nil, false},
+		{"source", SourceErrorFormatter, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sink := &testSink{}
+			l, err := NewWithSink(sink, LoggerConfig{
+				Enabled:        true,
+				Tag:            "app",
+				StableSchema:   true,
+				ErrorFormatter: test.formatter,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+
+			app := fiber.New()
+			app.Use(l.Logger())
+			app.Get("/ok", func(c *fiber.Ctx) error { return c.SendString("ok") })
+			app.Get("/fail", func(c *fiber.Ctx) error { return errors.New("boom") })
+			for _, path := range []string{"/ok", "/fail"} {
+				resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, path, nil))
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+			}
+
+			records := sink.received()
+			if len(records) != 2 {
+				t.Fatalf("got %d records, want 2", len(records))
+			}
+			ok, failed := records[0].record["error"], records[1].record["error"]
+			if test.str {
+				if ok != "" {
+					t.Errorf("error of the success = %#v, want \"\"", ok)
+				}
+				if _, isString := failed.(string); !isString {
+					t.Errorf("error of the failure = %#v, want a string", failed)
+				}
+			} else {
+				if m, isMap := ok.(map[string]interface{}); !isMap || len(m) != 0 {
+					t.Errorf("error of the success = %#v, want {}", ok)
+				}
+				if _, isMap := failed.(map[string]interface{}); !isMap {
+					t.Errorf("error of the failure = %#v, want an object", failed)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+//*****************************************************************************
+
+// the fields holding raw bodies, which are parsed before being redacted
+var bodyFields = map[string]bool{
+	"request_body":  true,
+	"response_body": true,
+}
+
+//-----------------------------------------------------------------------------
+
+// redact masks the values of the sensitive keys and the matches of the
+// sensitive patterns in the record
+func (l *Logger) redact(record map[string]interface{}) {
+	config := l.config()
+	if len(config.RedactKeys) == 0 && len(config.RedactPatterns) == 0 {
+		return
+	}
+
+	for k, v := range record {
+		if s, ok := v.(string); ok && bodyFields[k] {
+			record[k] = l.redactBody(s)
+			continue
+		}
+		record[k] = l.redactValue(k, v)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// redactValue returns v redacted, given it is found under key. The nested
+// maps and slices may belong to the application (locals, global fields,
+// claims...), so they are copied rather than redacted in place
+func (l *Logger) redactValue(key string, v interface{}) interface{} {
+	if l.redactedKey(key) {
+		return Redacted
+	}
+
+	switch v := v.(type) {
+	case string:
+		return l.redactString(v)
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			redacted[k] = l.redactValue(k, value)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, value := range v {
+			redacted[i] = l.redactValue("", value)
+		}
+		return redacted
+	case []string:
+		redacted := make([]string, len(v))
+		for i, value := range v {
+			redacted[i] = l.redactString(value)
+		}
+		return redacted
+	default:
+		return v
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// redactedKey tells whether the values under key must be masked
+func (l *Logger) redactedKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, redacted := range l.config().RedactKeys {
+		if strings.EqualFold(key, redacted) {
+			return true
+		}
+	}
+	return false
+}
+
+//-----------------------------------------------------------------------------
+
+// redactString replaces the matches of the sensitive patterns
+func (l *Logger) redactString(s string) string {
+	for _, pattern := range l.config().RedactPatterns {
+		s = pattern.ReplaceAllString(s, Redacted)
+	}
+	return s
+}
+
+//-----------------------------------------------------------------------------
+
+// redactBody redacts a JSON or form encoded body by keys and patterns; other
+// bodies only by patterns. A truncated JSON body cannot be parsed, so only
+// the patterns apply to it
+func (l *Logger) redactBody(body string) string {
+	trimmed := strings.TrimSpace(body)
+
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(trimmed), &parsed); err == nil {
+			if data, err := json.Marshal(l.redactValue("", parsed)); err == nil {
+				return string(data)
+			}
+		}
+		return l.redactString(body)
+	}
+
+	if len(l.config().RedactKeys) > 0 && strings.Contains(trimmed, "=") && !strings.ContainsAny(trimmed, " \n") {
+		if values, err := url.ParseQuery(trimmed); err == nil {
+			for key := range values {
+				if l.redactedKey(key) {
+					values[key] = []string{Redacted}
+				}
+			}
+			return l.redactString(values.Encode())
+		}
+	}
+
+	return l.redactString(body)
+}
@@ -0,0 +1,80 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// TestRedactKeepsCallerMaps checks that redacting a record leaves the nested
+// maps of the application unchanged, while the posted record is redacted
+func TestRedactKeepsCallerMaps(t *testing.T) {
+	sink := &testSink{}
+	global := map[string]interface{}{"db": map[string]interface{}{"password": "global-secret"}}
+	l, err := NewWithSink(sink, LoggerConfig{
+		Enabled:      true,
+		Tag:          "app",
+		RedactKeys:   []string{"password"},
+		GlobalFields: map[string]interface{}{"service": global},
+		LocalsKeys:   map[string]string{"user": "user"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	user := map[string]interface{}{
+		"name":   "u1",
+		"logins": []interface{}{map[string]interface{}{"password": "old-secret"}},
+		"auth":   map[string]interface{}{"password": "secret"},
+	}
+	app := fiber.New()
+	app.Use(l.Logger())
+	app.Get("/", func(c *fiber.Ctx) error {
+		c.Locals("user", user)
+		return c.SendString("ok")
+	})
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if got := user["auth"].(map[string]interface{})["password"]; got != "secret" {
+		t.Errorf("locals map changed: password = %v", got)
+	}
+	if got := user["logins"].([]interface{})[0].(map[string]interface{})["password"]; got != "old-secret" {
+		t.Errorf("locals slice changed: password = %v", got)
+	}
+	if got := global["db"].(map[string]interface{})["password"]; got != "global-secret" {
+		t.Errorf("global field changed: password = %v", got)
+	}
+
+	records := sink.received()
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	posted, _ := records[0].record["user"].(map[string]interface{})
+	if auth, _ := posted["auth"].(map[string]interface{}); auth["password"] != Redacted {
+		t.Errorf("posted user = %v, want its password redacted", posted)
+	}
+}
@@ -0,0 +1,97 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+//*****************************************************************************
+
+// config returns the current configuration, which must not be modified
+func (l *Logger) config() *LoggerConfig {
+	return l.current.Load()
+}
+
+//-----------------------------------------------------------------------------
+
+// SetEnabled turns the logging on or off at runtime. While disabled, the
+// requests pass through the middleware and no record is posted. The loggers
+// created disabled never post anything, SetEnabled does nothing on them
+func (l *Logger) SetEnabled(enabled bool) {
+	if l.noop {
+		return
+	}
+	l.disabled.Store(!enabled)
+}
+
+//-----------------------------------------------------------------------------
+
+// Enabled tells whether the logging is on, see SetEnabled
+func (l *Logger) Enabled() bool {
+	return !l.disabled.Load()
+}
+
+//-----------------------------------------------------------------------------
+
+// UpdateConfig replaces the configuration at runtime, e.g. to change the
+// sampling rates from an admin endpoint. Config.Enabled is applied as
+// SetEnabled. The options read when the logger is created keep their values:
+// the Fluentd connection (Host, Port, FluentConfig, Endpoints, Balance...),
+// the async queue, the batches, the spool, the health checks and the panic,
+// replay and latency anomaly detectors. An invalid configuration is
+// rejected with an error wrapping ErrInvalidConfig, the current one is kept
+func (l *Logger) UpdateConfig(config LoggerConfig) error {
+	if err := validate(config, false); err != nil {
+		return err
+	}
+	setDefaults(&config)
+
+	current := l.config()
+	config.Host = current.Host
+	config.Port = current.Port
+	config.FluentConfig = current.FluentConfig
+	config.SubSecondPrecision = current.SubSecondPrecision
+	config.RequestAck = current.RequestAck
+	config.MarshalAsJSON = current.MarshalAsJSON
+	config.TLS = current.TLS
+	config.HTTPURL = current.HTTPURL
+	config.HTTPGzip = current.HTTPGzip
+	config.HTTPHeaders = current.HTTPHeaders
+	config.HTTPClient = current.HTTPClient
+	config.DryRun = current.DryRun
+	config.DryRunWriter = current.DryRunWriter
+	config.Endpoints = current.Endpoints
+	config.Balance = current.Balance
+	config.HealthCheckInterval = current.HealthCheckInterval
+	config.AsyncQueueSize = current.AsyncQueueSize
+	config.AsyncWorkers = current.AsyncWorkers
+	config.BatchSize = current.BatchSize
+	config.BatchInterval = current.BatchInterval
+	config.SpoolDir = current.SpoolDir
+	config.SpoolMaxBytes = current.SpoolMaxBytes
+	config.SpoolFileMaxBytes = current.SpoolFileMaxBytes
+	config.PanicDedupWindow = current.PanicDedupWindow
+	config.ErrorDedupWindow = current.ErrorDedupWindow
+	config.PanicStackWindow = current.PanicStackWindow
+	config.DetectReplays = current.DetectReplays
+	config.ReplayWindow = current.ReplayWindow
+	config.ReplayCapacity = current.ReplayCapacity
+	config.DetectLatencyAnomalies = current.DetectLatencyAnomalies
+	config.LatencyBaselineWindow = current.LatencyBaselineWindow
+	config.LatencyAnomalyFactor = current.LatencyAnomalyFactor
+
+	l.current.Store(&config)
+	l.SetEnabled(config.Enabled)
+	return nil
+}
@@ -0,0 +1,91 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// serve sends a GET request of path to an app using handler
+func serve(t *testing.T, handler fiber.Handler, path string) {
+	t.Helper()
+	app := fiber.New()
+	app.Use(handler)
+	app.Get("/*", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, path, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+//-----------------------------------------------------------------------------
+
+// TestNoopLoggerSetEnabled checks that a logger created disabled posts
+// nothing even once enabled
+func TestNoopLoggerSetEnabled(t *testing.T) {
+	sink := &testSink{}
+	l, err := New(LoggerConfig{Tag: "app", Sinks: []Sink{sink}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	l.SetEnabled(true)
+	if l.Enabled() {
+		t.Error("no-op logger enabled")
+	}
+	serve(t, l.Logger(), "/")
+	if records := sink.received(); len(records) != 0 {
+		t.Errorf("no-op logger posted %v", records)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// TestUpdateConfigInvalid checks that an invalid configuration is rejected
+// and the current one kept
+func TestUpdateConfigInvalid(t *testing.T) {
+	l, err := NewWithSink(&testSink{}, LoggerConfig{Enabled: true, Tag: "app", SampleRate: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	err = l.UpdateConfig(LoggerConfig{Enabled: true, Tag: "app", SampleRate: 2})
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("UpdateConfig error = %v, want ErrInvalidConfig", err)
+	}
+	if rate := l.config().SampleRate; rate != 1 {
+		t.Errorf("SampleRate = %v, want the kept 1", rate)
+	}
+
+	if err := l.UpdateConfig(LoggerConfig{Enabled: true, Tag: "api", SampleRate: 0.5}); err != nil {
+		t.Fatal(err)
+	}
+	if tag := l.config().Tag; tag != "api" {
+		t.Errorf("Tag = %q, want api", tag)
+	}
+}
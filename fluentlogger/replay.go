@@ -0,0 +1,113 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"container/list"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+const (
+	defaultReplayWindow   = time.Minute
+	defaultReplayCapacity = 10000
+)
+
+//-----------------------------------------------------------------------------
+
+// replayDetector remembers the signatures of recent requests in a bounded
+// LRU. Signatures are 64-bit FNV hashes, so memory stays at a few dozen bytes
+// per entry, at the cost of false positives:
+//   - two different requests may hash to the same signature (rare);
+//   - legitimately repeated requests (e.g. polling the same GET) are
+//     reported as replays too.
+//
+// Once the capacity is reached the least recently seen signature is evicted,
+// so under heavy traffic a replay may be missed (false negative).
+type replayDetector struct {
+	mu       sync.Mutex
+	window   time.Duration
+	capacity int
+	entries  map[uint64]*list.Element
+	order    *list.List // most recently seen first
+}
+
+type replayEntry struct {
+	signature uint64
+	seen      time.Time
+}
+
+//-----------------------------------------------------------------------------
+
+// newReplayDetector creates a detector, using the defaults for zero values
+func newReplayDetector(window time.Duration, capacity int) *replayDetector {
+	if window <= 0 {
+		window = defaultReplayWindow
+	}
+	if capacity <= 0 {
+		capacity = defaultReplayCapacity
+	}
+	return &replayDetector{
+		window:   window,
+		capacity: capacity,
+		entries:  make(map[uint64]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// seen records the signature and tells whether it was already recorded
+// within the window
+func (d *replayDetector) seen(signature uint64, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if element, ok := d.entries[signature]; ok {
+		entry := element.Value.(*replayEntry)
+		replay := now.Sub(entry.seen) <= d.window
+		entry.seen = now
+		d.order.MoveToFront(element)
+		return replay
+	}
+
+	d.entries[signature] = d.order.PushFront(&replayEntry{signature: signature, seen: now})
+	if d.order.Len() > d.capacity {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.entries, oldest.Value.(*replayEntry).signature)
+	}
+	return false
+}
+
+//-----------------------------------------------------------------------------
+
+// requestSignature hashes the method, path and body of the request
+func requestSignature(c *fiber.Ctx) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(c.Method()))
+	h.Write([]byte{0})
+	h.Write([]byte(c.Path()))
+	h.Write([]byte{0})
+	h.Write(c.Body())
+	return h.Sum64()
+}
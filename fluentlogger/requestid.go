@@ -0,0 +1,60 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"strings"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// RequestIDLocal is the c.Locals key of the request ID. It is the same key
+// used by Fiber's requestid middleware, so both can be combined
+const RequestIDLocal = "requestid"
+
+// the maximum length of a request ID taken from the request headers
+const maxRequestIDLength = 128
+
+//-----------------------------------------------------------------------------
+
+// RequestID returns the ID of the request, or "" when there is none
+func RequestID(c *fiber.Ctx) string {
+	id, _ := c.Locals(RequestIDLocal).(string)
+	return id
+}
+
+//-----------------------------------------------------------------------------
+
+// ensureRequestID makes sure the request has an ID, reusing the one set by
+// an earlier middleware or sent by the client, and echoes it in the response
+func (l *Logger) ensureRequestID(c *fiber.Ctx) {
+	config := l.config()
+	id := RequestID(c)
+	if id == "" {
+		id = c.Get(config.RequestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = config.IDGenerator()
+		} else {
+			// the header value lives in a request buffer
+			id = strings.Clone(id)
+		}
+		c.Locals(RequestIDLocal, id)
+	}
+	c.Set(config.RequestIDHeader, id)
+}
@@ -0,0 +1,217 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+//*****************************************************************************
+
+// ErrCircuitOpen is returned for the posts skipped while the circuit breaker
+// is open, see BreakerThreshold
+var ErrCircuitOpen = errors.New("fluentd circuit breaker open")
+
+// ErrPostTimeout is wrapped by the error of the posts which did not complete
+// within PostTimeout
+var ErrPostTimeout = errors.New("fluentd post timed out")
+
+var (
+	// errPostAbandoned marks the timed out posts left running, which deal
+	// with their own outcome, see tryPost
+	errPostAbandoned = errors.New("post left running in the background")
+
+	// errPostDropped is returned for the posts not attempted because too
+	// many timed out ones are still running
+	errPostDropped = errors.New("fluentd post dropped, too many timed out posts running")
+)
+
+// the maximum number of timed out posts left running in the background
+const maxAbandonedPosts = 64
+
+const (
+	defaultPostRetryWait    = 50 * time.Millisecond
+	defaultPostRetryMaxWait = 2 * time.Second
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+//-----------------------------------------------------------------------------
+
+// breaker is a circuit breaker opening after some consecutive failures. Once
+// the cooldown is over a single probe goes through, closing it on success
+type breaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+//-----------------------------------------------------------------------------
+
+// allow tells whether a post may be attempted
+func (b *breaker) allow(now time.Time, threshold int) bool {
+	if threshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < threshold {
+		return true
+	}
+	if now.Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+//-----------------------------------------------------------------------------
+
+// record registers the outcome of an allowed post
+func (b *breaker) record(err error, now time.Time, threshold int, cooldown time.Duration) {
+	if threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	if b.failures++; b.failures >= threshold {
+		b.openUntil = now.Add(cooldown)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// retry runs post, retrying it PostRetries times with a jittered exponential
+// backoff, unless the circuit breaker is open. It gives up once ctx is done,
+// late getting the outcome of the attempt left running, see tryPost
+func (l *Logger) retry(ctx context.Context, post func() error, late func(error)) error {
+	config := l.config()
+	cooldown := config.BreakerCooldown
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	if !l.breaker.allow(time.Now(), config.BreakerThreshold) {
+		return ErrCircuitOpen
+	}
+
+	err := l.tryPost(ctx, post, late)
+retries:
+	for attempt := 0; err != nil && ctx.Err() == nil && attempt < config.PostRetries; attempt++ {
+		select {
+		case <-time.After(backoff(config.PostRetryWait, config.PostRetryMaxWait, attempt)):
+		case <-l.stop:
+			break retries // closing, no more waiting
+		case <-ctx.Done():
+			err = errors.Join(err, timeoutError(ctx))
+			break retries
+		}
+		err = l.tryPost(ctx, post, late)
+	}
+
+	l.breaker.record(err, time.Now(), config.BreakerThreshold, cooldown)
+	return err
+}
+
+//-----------------------------------------------------------------------------
+
+// tryPost runs post until ctx is done. A post still running then goes on in
+// the background and hands its error to late, if any, so the caller must
+// not rescue the message itself (the error wraps errPostAbandoned) and post
+// must not use memory reused by the caller. The writes on the own
+// connections are bounded by ctx, those of the Fluentd client only by its
+// WriteTimeout. While maxAbandonedPosts are running no post is attempted
+func (l *Logger) tryPost(ctx context.Context, post func() error, late func(error)) error {
+	if ctx.Done() == nil {
+		return post()
+	}
+	if len(l.abandoned) == cap(l.abandoned) {
+		return errPostDropped
+	}
+
+	var mu sync.Mutex
+	finished, abandoned, counted := false, false, false
+	done := make(chan error, 1)
+	go func() {
+		err := post()
+		mu.Lock()
+		defer mu.Unlock()
+		finished = true
+		if !abandoned {
+			done <- err
+			return
+		}
+		if counted {
+			<-l.abandoned
+		}
+		if late != nil {
+			late(err)
+		}
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if finished {
+		return <-done // finished meanwhile
+	}
+	abandoned = true
+	select {
+	case l.abandoned <- struct{}{}:
+		counted = true
+	default: // taken by a concurrent post since the check above
+	}
+	return fmt.Errorf("%w: %w", timeoutError(ctx), errPostAbandoned)
+}
+
+//-----------------------------------------------------------------------------
+
+// timeoutError returns the error of a post given up as ctx is done
+func timeoutError(ctx context.Context) error {
+	return fmt.Errorf("%w: %w", ErrPostTimeout, ctx.Err())
+}
+
+//-----------------------------------------------------------------------------
+
+// backoff returns the wait before the retry following attempt: base doubled
+// on every attempt up to max, with a random jitter of up to its half
+func backoff(base, max time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		base = defaultPostRetryWait
+	}
+	if max <= 0 {
+		max = defaultPostRetryMaxWait
+	}
+	wait := base << min(attempt, 30)
+	if wait <= 0 || wait > max {
+		wait = max
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
@@ -0,0 +1,59 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// the c.Locals key of the RouteOptions of the request
+const routeOptionsLocal = "fluentlogger.route_options"
+
+// RouteOptions override the configuration for the requests of a route, see
+// ForRoute. Unset fields keep the global values
+type RouteOptions struct {
+	Tag             string   // the tag (or tag template) of the records
+	SampleRate      *float64 // the sampling rate, replacing every rate and path rule
+	LogRequestBody  *bool
+	LogResponseBody *bool
+	Skip            bool // whether to post no access record for the route
+}
+
+//-----------------------------------------------------------------------------
+
+// ForRoute returns a handler attaching opts to the requests of a route, e.g.
+//
+//	app.Post("/upload", l.ForRoute(fiberfluentdlogger.RouteOptions{Tag: "app.upload"}), upload)
+//
+// It does not log by itself: the options are read by the Logger middleware
+// registered before it
+func (l *Logger) ForRoute(opts RouteOptions) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals(routeOptionsLocal, &opts)
+		return c.Next()
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// routeOptions returns the RouteOptions of the request, or nil
+func routeOptions(c *fiber.Ctx) *RouteOptions {
+	opts, _ := c.Locals(routeOptionsLocal).(*RouteOptions)
+	return opts
+}
@@ -0,0 +1,115 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"math/rand/v2"
+	"strconv"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// SampleRule sets the sample rate of the requests whose matched route or
+// path matches Pattern, a glob as in SkipPaths, e.g. {"/api/v1/metrics/*",
+// 0.01}; "*" also matches a route parameter such as ":name"
+type SampleRule struct {
+	Pattern string
+	Rate    float64
+}
+
+//-----------------------------------------------------------------------------
+
+// sampled tells whether the request has to be logged. The failed requests
+// (a handler error or a 5xx status) are always kept, unless the "5xx" rate
+// of StatusSampleRates is set, which then applies to the 5xx ones. For the
+// others an upstream decision wins, then the rate of the RouteOptions, the
+// path rules, the status class rates and finally the global rate apply
+func (l *Logger) sampled(c *fiber.Ctx, err error) bool {
+	config := l.config()
+	status := responseStatus(c, err)
+	if rate, ok := config.StatusSampleRates["5xx"]; ok && status >= fiber.StatusInternalServerError {
+		return rate >= 1 || rand.Float64() < rate
+	}
+	if err != nil || status >= fiber.StatusInternalServerError {
+		return true
+	}
+
+	if config.UpstreamSampling {
+		if decided, sampled := l.upstreamSampled(c); decided {
+			return sampled
+		}
+	}
+	rate, ok := l.sampleRate(c, status)
+	if !ok {
+		return true
+	}
+	return rate >= 1 || rand.Float64() < rate
+}
+
+//-----------------------------------------------------------------------------
+
+// sampleRate returns the rate applying to the request, if any, given the
+// status of its response
+func (l *Logger) sampleRate(c *fiber.Ctx, status int) (float64, bool) {
+	config := l.config()
+	if opts := routeOptions(c); opts != nil && opts.SampleRate != nil {
+		return *opts.SampleRate, true
+	}
+
+	route, p := c.Route().Path, c.Path()
+	for _, rule := range config.PathSampleRates {
+		if matchPath(rule.Pattern, route) || matchPath(rule.Pattern, p) {
+			return rule.Rate, true
+		}
+	}
+
+	if rate, ok := config.StatusSampleRates[statusClass(status)]; ok {
+		return rate, true
+	}
+
+	if config.SampleRate > 0 {
+		return config.SampleRate, true
+	}
+	return 0, false
+}
+
+//-----------------------------------------------------------------------------
+
+// statusClass returns the class of an HTTP status code, e.g. "2xx"
+func statusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
+
+//-----------------------------------------------------------------------------
+
+// upstreamSampled returns whether an upstream service made a sampling
+// decision for the request and, if so, whether it has to be logged
+func (l *Logger) upstreamSampled(c *fiber.Ctx) (decided bool, sampled bool) {
+	if value := c.Get(l.config().SampleHeader); value != "" {
+		if sampled, err := strconv.ParseBool(value); err == nil {
+			return true, sampled
+		}
+	}
+
+	tc, ok := parseTraceparent(c.Get(HeaderTraceparent))
+	if !ok {
+		return false, false
+	}
+	return true, tc.sampled()
+}
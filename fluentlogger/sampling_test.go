@@ -0,0 +1,83 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// TestSampledFailures checks that the failed requests are kept whatever the
+// rates and upstream decision, unless the "5xx" rate is set
+func TestSampledFailures(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		status int
+		err    error
+		rates  map[string]float64
+		want   int
+	}{
+		{"500 status", fiber.StatusInternalServerError, nil, nil, 1},
+		{"503 status", fiber.StatusServiceUnavailable, nil, map[string]float64{"2xx": 0}, 1},
+		{"handler error", 0, errors.New("boom"), nil, 1},
+		{"not found error", 0, fiber.ErrNotFound, nil, 1},
+		{"ok status", fiber.StatusOK, nil, nil, 0},
+		{"explicit 5xx rate", fiber.StatusInternalServerError, nil, map[string]float64{"5xx": 0}, 0},
+		{"explicit 5xx rate error", 0, errors.New("boom"), map[string]float64{"5xx": 0}, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sink := &testSink{}
+			l, err := NewWithSink(sink, LoggerConfig{
+				Enabled:           true,
+				Tag:               "app",
+				SampleRate:        1e-9,
+				StatusSampleRates: test.rates,
+				PathSampleRates:   []SampleRule{{Pattern: "/*", Rate: 1e-9}},
+				UpstreamSampling:  true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+
+			app := fiber.New()
+			app.Use(l.Logger())
+			app.Get("/", func(c *fiber.Ctx) error {
+				if test.err != nil {
+					return test.err
+				}
+				return c.SendStatus(test.status)
+			})
+			req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			req.Header.Set("X-Log-Sample", "0")
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if n := len(sink.received()); n != test.want {
+				t.Errorf("logged %d records, want %d", n, test.want)
+			}
+		})
+	}
+}
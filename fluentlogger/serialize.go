@@ -0,0 +1,121 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"maps"
+	"time"
+)
+
+//*****************************************************************************
+
+// Serializer converts a record value which Fluentd, or a plugin downstream,
+// does not take as is into one it does, reporting whether it applied to v
+type Serializer func(v interface{}) (interface{}, bool)
+
+//-----------------------------------------------------------------------------
+
+// TimeSerializer formats the time.Time values with layout, e.g.
+// time.RFC3339Nano
+func TimeSerializer(layout string) Serializer {
+	return func(v interface{}) (interface{}, bool) {
+		if t, ok := v.(time.Time); ok {
+			return t.Format(layout), true
+		}
+		return v, false
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// ErrorSerializer replaces the errors with their message
+func ErrorSerializer(v interface{}) (interface{}, bool) {
+	if err, ok := v.(error); ok {
+		return err.Error(), true
+	}
+	return v, false
+}
+
+//-----------------------------------------------------------------------------
+
+// StringerSerializer replaces the fmt.Stringer values with their String()
+func StringerSerializer(v interface{}) (interface{}, bool) {
+	if s, ok := v.(fmt.Stringer); ok {
+		return s.String(), true
+	}
+	return v, false
+}
+
+//-----------------------------------------------------------------------------
+
+// serialize runs the configured serializers on the values of a message,
+// descending into maps and arrays. The maps and arrays holding a converted
+// value are copied rather than modified, since they may belong to the caller
+func (l *Logger) serialize(message interface{}) interface{} {
+	serializers := l.config().Serializers
+	if len(serializers) == 0 {
+		return message
+	}
+	v, _ := serializeValue(serializers, message)
+	return v
+}
+
+//-----------------------------------------------------------------------------
+
+// serializeValue is serialize for a value, reporting whether it changed
+func serializeValue(serializers []Serializer, v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case nil, string, bool, int, int64, float64:
+		return v, false
+	case map[string]interface{}:
+		var clone map[string]interface{}
+		for k, value := range v {
+			if value, changed := serializeValue(serializers, value); changed {
+				if clone == nil {
+					clone = maps.Clone(v)
+				}
+				clone[k] = value
+			}
+		}
+		if clone == nil {
+			return v, false
+		}
+		return clone, true
+	case []interface{}:
+		var clone []interface{}
+		for i, value := range v {
+			if value, changed := serializeValue(serializers, value); changed {
+				if clone == nil {
+					clone = append([]interface{}(nil), v...)
+				}
+				clone[i] = value
+			}
+		}
+		if clone == nil {
+			return v, false
+		}
+		return clone, true
+	}
+
+	for _, serializer := range serializers {
+		if converted, ok := serializer(v); ok {
+			return converted, true
+		}
+	}
+	return v, false
+}
@@ -0,0 +1,128 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+//*****************************************************************************
+
+// JSONSink writes the records as JSON lines ({"tag":..., "time":...,
+// "record":...}), the format of FallbackWriter, e.g. to os.Stdout or to a
+// local file during development
+type JSONSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+//-----------------------------------------------------------------------------
+
+// NewJSONSink returns a sink writing to w
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{w: w}
+}
+
+//-----------------------------------------------------------------------------
+
+// OpenJSONSink returns a sink appending to the file at path, created if
+// needed. The file is closed by Close
+func OpenJSONSink(path string) (*JSONSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONSink{w: f}, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// Post writes a record as one JSON line
+func (s *JSONSink) Post(tag string, t time.Time, message interface{}) error {
+	data, err := json.Marshal(fallbackEvent{Tag: tag, Time: t, Record: message})
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(data)
+	return err
+}
+
+//-----------------------------------------------------------------------------
+
+// Close closes the underlying writer when it is an io.Closer other than the
+// standard streams
+func (s *JSONSink) Close() error {
+	if s.w == os.Stdout || s.w == os.Stderr {
+		return nil
+	}
+	if closer, ok := s.w.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// FilteredSink passes to Sink only part of the records, so each of the
+// Sinks can get its own share, e.g. the errors to a file and a sample of
+// everything to stdout. Tags, path.Match globs such as "app.*", and Filter
+// must accept
+// the record, then SampleRate, from 0 to 1 (0 keeps everything), applies
+type FilteredSink struct {
+	Sink       Sink
+	Tags       []string
+	Filter     func(tag string, message interface{}) bool
+	SampleRate float64
+}
+
+//-----------------------------------------------------------------------------
+
+// Post forwards the record to Sink when it passes the filters
+func (f *FilteredSink) Post(tag string, t time.Time, message interface{}) error {
+	if len(f.Tags) > 0 && !matchTag(f.Tags, tag) {
+		return nil
+	}
+	if f.Filter != nil && !f.Filter(tag, message) {
+		return nil
+	}
+	if f.SampleRate > 0 && f.SampleRate < 1 && rand.Float64() >= f.SampleRate {
+		return nil
+	}
+	return f.Sink.Post(tag, t, message)
+}
+
+//-----------------------------------------------------------------------------
+
+// matchTag tells whether tag matches one of the patterns
+func matchTag(patterns []string, tag string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, tag); matched {
+			return true
+		}
+	}
+	return false
+}
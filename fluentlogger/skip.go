@@ -0,0 +1,62 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"path"
+	"strings"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// skip tells whether the request must not be logged
+func (l *Logger) skip(c *fiber.Ctx) bool {
+	config := l.config()
+	if config.Next != nil && config.Next(c) {
+		return true
+	}
+
+	for _, method := range config.SkipMethods {
+		if strings.EqualFold(c.Method(), method) {
+			return true
+		}
+	}
+
+	p := c.Path()
+	for _, pattern := range config.SkipPaths {
+		if matchPath(pattern, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//-----------------------------------------------------------------------------
+
+// matchPath matches p against a path.Match pattern, e.g. "/healthz" or
+// "/api/*/status". A trailing "/**" matches the prefix and everything below
+// it, e.g. "/static/**"
+func matchPath(pattern, p string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return p == prefix || strings.HasPrefix(p, prefix+"/")
+	}
+	matched, _ := path.Match(pattern, p)
+	return matched
+}
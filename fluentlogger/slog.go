@@ -0,0 +1,187 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"time"
+)
+
+//*****************************************************************************
+
+type SlogOptions struct {
+	Tag       string       // the suffix of the tag, "<Tag>.app" by default
+	Level     slog.Leveler // the minimum level handled, slog.LevelInfo by default
+	AddSource bool         // whether to log the caller as "source"
+}
+
+//-----------------------------------------------------------------------------
+
+// SlogHandler is a slog.Handler sending the application logs through the
+// Fluentd connection of a Logger, so request and application logs share one
+// pipeline (async queue, sinks, fallback...)
+type SlogHandler struct {
+	l      *Logger
+	tag    string
+	opts   SlogOptions
+	attrs  []groupedAttr // attributes added with WithAttrs
+	groups []string      // the groups opened with WithGroup
+}
+
+type groupedAttr struct {
+	groups []string
+	attr   slog.Attr
+}
+
+//-----------------------------------------------------------------------------
+
+// SlogHandler returns a slog.Handler posting to the tag namespace of the
+// Logger. opts may be nil
+//
+//	slog.SetDefault(slog.New(logger.SlogHandler(nil)))
+func (l *Logger) SlogHandler(opts *SlogOptions) *SlogHandler {
+	h := &SlogHandler{l: l}
+	if opts != nil {
+		h.opts = *opts
+	}
+	if h.opts.Tag == "" {
+		h.opts.Tag = "app"
+	}
+	if h.opts.Level == nil {
+		h.opts.Level = slog.LevelInfo
+	}
+	h.tag = l.baseTag() + "." + h.opts.Tag
+	return h
+}
+
+//-----------------------------------------------------------------------------
+
+// Enabled implements slog.Handler
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.opts.Level.Level()
+}
+
+//-----------------------------------------------------------------------------
+
+// Handle implements slog.Handler
+func (h *SlogHandler) Handle(_ context.Context, r slog.Record) error {
+	record := map[string]interface{}{
+		"level": r.Level.String(),
+		"msg":   r.Message,
+	}
+	if h.opts.AddSource && r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		record["source"] = fmt.Sprintf("%s:%d", frame.File, frame.Line)
+	}
+
+	for _, ga := range h.attrs {
+		addSlogAttr(group(record, ga.groups), ga.attr)
+	}
+	target := group(record, h.groups)
+	r.Attrs(func(attr slog.Attr) bool {
+		addSlogAttr(target, attr)
+		return true
+	})
+
+	h.l.addGlobalFields(record)
+	h.l.redact(record)
+	h.l.stringifyNumbers(record)
+	h.l.send(h.tag, record)
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// WithAttrs implements slog.Handler
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append([]groupedAttr(nil), h.attrs...)
+	for _, attr := range attrs {
+		clone.attrs = append(clone.attrs, groupedAttr{groups: h.groups, attr: attr})
+	}
+	return &clone
+}
+
+//-----------------------------------------------------------------------------
+
+// WithGroup implements slog.Handler
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.groups = append(append([]string(nil), h.groups...), name)
+	return &clone
+}
+
+//-----------------------------------------------------------------------------
+
+// group returns the nested map of record for the group path, creating it
+func group(record map[string]interface{}, groups []string) map[string]interface{} {
+	for _, name := range groups {
+		next, ok := record[name].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			record[name] = next
+		}
+		record = next
+	}
+	return record
+}
+
+//-----------------------------------------------------------------------------
+
+// addSlogAttr adds an attribute to m, converting its value to a type every
+// Fluentd encoding supports
+func addSlogAttr(m map[string]interface{}, attr slog.Attr) {
+	value := attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	switch value.Kind() {
+	case slog.KindGroup:
+		attrs := value.Group()
+		if len(attrs) == 0 {
+			return
+		}
+		target := m
+		if attr.Key != "" {
+			target = group(m, []string{attr.Key})
+		}
+		for _, a := range attrs {
+			addSlogAttr(target, a)
+		}
+	case slog.KindTime:
+		m[attr.Key] = value.Time().Format(time.RFC3339Nano)
+	case slog.KindDuration:
+		m[attr.Key] = value.Duration().String()
+	default:
+		v := value.Any()
+		switch v := v.(type) {
+		case error:
+			m[attr.Key] = v.Error()
+		case fmt.Stringer:
+			m[attr.Key] = v.String()
+		default:
+			m[attr.Key] = v
+		}
+	}
+}
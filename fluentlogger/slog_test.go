@@ -0,0 +1,39 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"log/slog"
+	"testing"
+)
+
+//*****************************************************************************
+
+// TestSlogHandlerBaseTag checks the tag of the slog records with an empty
+// Tag and a TagFunc
+func TestSlogHandlerBaseTag(t *testing.T) {
+	sink := &testSink{}
+	l := newTagFuncLogger(t, sink, "")
+	slog.New(l.SlogHandler(nil)).Info("started", "port", 8080)
+	records := sink.received()
+	if want := ConfigDefault.Tag + ".app"; len(records) != 1 || records[0].tag != want {
+		t.Fatalf("got %v, want one record tagged %q", records, want)
+	}
+	if msg := records[0].record["msg"]; msg != "started" {
+		t.Errorf("msg = %v, want started", msg)
+	}
+}
@@ -0,0 +1,306 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//*****************************************************************************
+
+const (
+	defaultSpoolMaxBytes     = 256 << 20
+	defaultSpoolFileMaxBytes = 8 << 20
+
+	spoolMinBackoff = time.Second
+	spoolMaxBackoff = time.Minute
+
+	spoolPrefix = "spool-"
+	spoolSuffix = ".jsonl"
+)
+
+//-----------------------------------------------------------------------------
+
+// spool appends undeliverable records to files in a directory, as JSON lines
+// in the FallbackWriter format. Files are named after an increasing sequence
+// number, so sorting their names gives the order to replay them
+type spool struct {
+	mu           sync.Mutex
+	dir          string
+	maxBytes     int64
+	fileMaxBytes int64
+	size         int64 // bytes in the whole spool
+	seq          uint64
+	current      *os.File
+	currentSize  int64
+}
+
+//-----------------------------------------------------------------------------
+
+// openSpool opens SpoolDir, if configured, and starts replaying what it
+// holds, including what previous runs left behind
+func (l *Logger) openSpool() error {
+	config := l.config()
+	if config.SpoolDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(config.SpoolDir, 0o750); err != nil {
+		return err
+	}
+
+	s := &spool{
+		dir:          config.SpoolDir,
+		maxBytes:     config.SpoolMaxBytes,
+		fileMaxBytes: config.SpoolFileMaxBytes,
+	}
+	if s.maxBytes <= 0 {
+		s.maxBytes = defaultSpoolMaxBytes
+	}
+	if s.fileMaxBytes <= 0 {
+		s.fileMaxBytes = defaultSpoolFileMaxBytes
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	for _, name := range files {
+		if info, err := os.Stat(filepath.Join(s.dir, name)); err == nil {
+			s.size += info.Size()
+		}
+		if seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, spoolPrefix), spoolSuffix), 10, 64); err == nil && seq >= s.seq {
+			s.seq = seq + 1
+		}
+	}
+
+	l.spool = s
+	go l.replaySpool()
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// files returns the names of the spool files, oldest first
+func (s *spool) files() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, spoolPrefix) && strings.HasSuffix(name, spoolSuffix) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// append spools a message, rotating the current file when it is full
+func (s *spool) append(tag string, t time.Time, message interface{}) error {
+	data, err := json.Marshal(fallbackEvent{Tag: tag, Time: t, Record: message})
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size+int64(len(data)) > s.maxBytes {
+		return fmt.Errorf("spool full, limit %d bytes", s.maxBytes)
+	}
+	if s.current == nil || s.currentSize >= s.fileMaxBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.current.Write(data)
+	s.currentSize += int64(n)
+	s.size += int64(n)
+	return err
+}
+
+//-----------------------------------------------------------------------------
+
+// rotate closes the current file and opens the next one. Caller must hold mu
+func (s *spool) rotate() error {
+	s.closeCurrent()
+
+	name := fmt.Sprintf("%s%020d%s", spoolPrefix, s.seq, spoolSuffix)
+	file, err := os.OpenFile(filepath.Join(s.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	s.seq++
+	s.current = file
+	s.currentSize = 0
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// closeCurrent closes the file being written. Caller must hold mu
+func (s *spool) closeCurrent() {
+	if s.current != nil {
+		s.current.Close()
+		s.current = nil
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// close closes the file being written; its content is replayed on next run
+func (s *spool) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeCurrent()
+}
+
+//-----------------------------------------------------------------------------
+
+// replaySpool posts the spooled records to Fluentd until Close, backing off
+// exponentially while Fluentd keeps refusing them
+func (l *Logger) replaySpool() {
+	backoff := spoolMinBackoff
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-timer.C:
+		}
+
+		if err := l.spool.replay(l.replayPost); err != nil {
+			backoff = min(backoff*2, spoolMaxBackoff)
+		} else {
+			backoff = spoolMinBackoff
+		}
+		timer.Reset(backoff)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// replayPost posts a spooled record to Fluentd. A post left running at
+// PostTimeout is waited for, so the line is only removed once delivered and
+// kept if it fails; the writes are bounded by the context being done
+func (l *Logger) replayPost(tag string, t time.Time, message interface{}) error {
+	ctx, cancel := l.postContext()
+	defer cancel()
+	outcome := make(chan error, 1)
+	err := l.tryPost(ctx, func() error { return l.postFluent(ctx, tag, t, message) }, func(err error) {
+		outcome <- err
+	})
+	if errors.Is(err, errPostAbandoned) {
+		err = <-outcome
+	}
+	return err
+}
+
+//-----------------------------------------------------------------------------
+
+// replay posts the spool files in order with post, removing each one once it
+// is fully delivered. On failure the undelivered lines are kept
+func (s *spool) replay(post func(string, time.Time, interface{}) error) error {
+	s.mu.Lock()
+	if s.currentSize > 0 {
+		// make the file being written replayable; appends go to a new one
+		s.closeCurrent()
+	}
+	files, err := s.files()
+	if s.current != nil && len(files) > 0 {
+		files = files[:len(files)-1]
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range files {
+		if err := s.replayFile(filepath.Join(s.dir, name), post); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// replayFile posts the lines of a spool file, removing it when done or
+// rewriting it with the lines left when a post fails
+func (s *spool) replayFile(path string, post func(string, time.Time, interface{}) error) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	offset := 0
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var event struct {
+			Tag    string      `json:"tag"`
+			Time   time.Time   `json:"time"`
+			Record interface{} `json:"record"`
+		}
+		// malformed lines (e.g. a partial write) are skipped
+		if json.Unmarshal(line, &event) == nil {
+			if err := post(event.Tag, event.Time, event.Record); err != nil {
+				if werr := os.WriteFile(path, data[offset:], 0o640); werr != nil {
+					return werr
+				}
+				s.shrink(int64(offset))
+				return err
+			}
+		}
+		offset += len(line) + 1
+	}
+
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	s.shrink(int64(len(data)))
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// shrink accounts for n bytes leaving the spool
+func (s *spool) shrink(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.size = max(s.size-n, 0)
+}
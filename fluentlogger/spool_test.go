@@ -0,0 +1,52 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"testing"
+	"time"
+)
+
+//*****************************************************************************
+
+// TestReplayLateSuccess checks that a spooled record whose replay outlives
+// PostTimeout but succeeds is removed from the spool, not replayed again
+func TestReplayLateSuccess(t *testing.T) {
+	endpoint := &testSink{delay: 100 * time.Millisecond}
+	dir := t.TempDir()
+	l, err := NewWithSink(endpoint, LoggerConfig{
+		Enabled:     true,
+		Tag:         "app",
+		PostTimeout: 20 * time.Millisecond,
+		SpoolDir:    dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if err := l.spool.append("app.test", time.Now(), map[string]interface{}{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first replay runs after spoolMinBackoff, the next one a second later
+	eventually(t, 3*time.Second, func() bool { return spooledLines(t, dir) == 0 })
+	time.Sleep(spoolMinBackoff + 200*time.Millisecond)
+	if n := endpoint.attempts(); n != 1 {
+		t.Errorf("record posted %d times, want 1", n)
+	}
+}
@@ -0,0 +1,195 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bufio"
+	"io"
+	"sync"
+	"time"
+
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+//*****************************************************************************
+
+// streamStateLocal holds the *streamState set by SetBodyStreamWriter
+const streamStateLocal = "fluentlogger.stream_state"
+
+//-----------------------------------------------------------------------------
+
+// streamCounter wraps the body stream of a response, counting the bytes
+// Fiber reads from it. fasthttp closes the stream once the response is
+// written or abandoned, which calls done. Only the readers without a Close
+// are wrapped, see sendAfterStream
+type streamCounter struct {
+	r    io.Reader
+	n    int64
+	once sync.Once
+	done func(n int64)
+}
+
+//-----------------------------------------------------------------------------
+
+func (s *streamCounter) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.n += int64(n)
+	return n, err
+}
+
+//-----------------------------------------------------------------------------
+
+func (s *streamCounter) Close() error {
+	var err error
+	if closer, ok := s.r.(io.Closer); ok {
+		err = closer.Close()
+	}
+	s.once.Do(func() { s.done(s.n) })
+	return err
+}
+
+//-----------------------------------------------------------------------------
+
+// sendAfterStream posts the record of a streamed response (SendStream,
+// SetBodyStreamWriter, server-sent events) once the stream ends rather than
+// when the handler returns. It adds "stream_bytes" and "stream_duration_ms",
+// the time spent streaming, and updates "response_size" and "latency_ms"
+// when they are at the top level of the record. It returns false, posting
+// nothing, for the streams it can't follow (see SetBodyStreamWriter)
+func (l *Logger) sendAfterStream(c *fiber.Ctx, tag string, start time.Time, record map[string]interface{}) bool {
+	record = cloneRecord(record) // the pooled record is reused once the handler returns
+	config := l.config()
+	resp := c.Response()
+	handled := l.now().Sub(start)
+	streamStart := time.Now() // the ends of the streams come from the wall clock, not Clock
+
+	done := func(n int64, end time.Time) {
+		streamed := end.Sub(streamStart)
+		record["stream_bytes"] = n
+		record["stream_duration_ms"] = streamed.Milliseconds()
+		if _, ok := record["response_size"]; ok {
+			record["response_size"] = n
+		}
+		if _, ok := record["latency_ms"]; ok {
+			latency := handled + streamed
+			if config.LatencyMsFloat {
+				record["latency_ms"] = l.roundLatency(float64(latency) / float64(time.Millisecond))
+			} else {
+				record["latency_ms"] = latency.Milliseconds()
+			}
+		}
+
+		var message interface{} = record
+		if len(config.CompactFields) > 0 {
+			message = l.compact(record)
+		}
+		l.sendAt(tag, start, message)
+	}
+
+	if state, ok := c.Locals(streamStateLocal).(*streamState); ok {
+		state.onDone(done)
+		return true
+	}
+	body := resp.BodyStream()
+	if _, ok := body.(io.Closer); ok {
+		// SetBodyStream would close it
+		return false
+	}
+	counter := &streamCounter{r: body, done: func(n int64) { done(n, time.Now()) }}
+	resp.SetBodyStream(counter, resp.Header.ContentLength())
+	return true
+}
+
+//-----------------------------------------------------------------------------
+
+// streamState tracks a body stream writer installed with SetBodyStreamWriter.
+// fasthttp may run the writer before the logger gets to register done, so
+// whichever comes last calls it
+type streamState struct {
+	mu       sync.Mutex
+	n        int64
+	finished bool
+	end      time.Time
+	done     func(n int64, end time.Time)
+}
+
+//-----------------------------------------------------------------------------
+
+func (s *streamState) finish() {
+	s.mu.Lock()
+	s.finished = true
+	s.end = time.Now()
+	done := s.done
+	s.mu.Unlock()
+	if done != nil {
+		done(s.n, s.end)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func (s *streamState) onDone(done func(n int64, end time.Time)) {
+	s.mu.Lock()
+	s.done = done
+	finished := s.finished
+	s.mu.Unlock()
+	if finished {
+		done(s.n, s.end)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// countingWriter counts the bytes going to the response, flushing them at
+// once so the flushes of the handler (e.g. server-sent events) still reach
+// the client
+type countingWriter struct {
+	w *bufio.Writer
+	s *streamState
+}
+
+//-----------------------------------------------------------------------------
+
+func (cw countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.s.mu.Lock()
+	cw.s.n += int64(n)
+	cw.s.mu.Unlock()
+	if err != nil {
+		return n, err
+	}
+	return n, cw.w.Flush()
+}
+
+//-----------------------------------------------------------------------------
+
+// SetBodyStreamWriter is c.Context().SetBodyStreamWriter for the handlers
+// logged with LogStreams: the access record waits for sw to return and
+// carries the bytes it wrote. The streams set directly through fasthttp
+// can't be followed without closing them, so their records are posted when
+// the handler returns
+func SetBodyStreamWriter(c *fiber.Ctx, sw fasthttp.StreamWriter) {
+	state := &streamState{}
+	c.Locals(streamStateLocal, state)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer state.finish()
+		cw := bufio.NewWriter(countingWriter{w: w, s: state})
+		sw(cw)
+		_ = cw.Flush()
+	})
+}
@@ -0,0 +1,176 @@
+// Package syslogsink provides a sink writing the middleware records to a
+// local or remote syslog daemon as RFC 5424 messages.
+package syslogsink
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+//*****************************************************************************
+
+const (
+	FacilityUser   = 1  // user-level messages
+	FacilityLocal0 = 16 // local use 0
+
+	SeverityError   = 3
+	SeverityWarning = 4
+	SeverityInfo    = 6
+)
+
+// the sockets where local syslog daemons usually listen
+var localSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+//-----------------------------------------------------------------------------
+
+type Config struct {
+	Network  string // "udp", "tcp", "unix" or "unixgram"; empty for the local daemon
+	Address  string // the syslog server address, ignored for the local daemon
+	Facility int    // the syslog facility, FacilityUser by default
+	Severity int    // the syslog severity, SeverityInfo by default
+	AppName  string // the APP-NAME of the messages, the executable name by default
+	Hostname string // the HOSTNAME of the messages, os.Hostname() by default
+}
+
+//-----------------------------------------------------------------------------
+
+// Sink writes records to syslog. The tag becomes the MSGID and the record is
+// serialized as JSON in the MSG part
+type Sink struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	config  Config
+	framed  bool // whether messages need octet-counting framing (stream transports)
+	procID  string
+	appName string
+	host    string
+}
+
+//-----------------------------------------------------------------------------
+
+// New connects to the syslog daemon described by config
+func New(config Config) (*Sink, error) {
+	if config.Facility == 0 {
+		config.Facility = FacilityUser
+	}
+	if config.Severity == 0 {
+		config.Severity = SeverityInfo
+	}
+	if config.AppName == "" {
+		config.AppName = filepath.Base(os.Args[0])
+	}
+	if config.Hostname == "" {
+		config.Hostname, _ = os.Hostname()
+	}
+
+	conn, err := dial(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sink{
+		conn:    conn,
+		config:  config,
+		framed:  config.Network == "tcp" || config.Network == "unix",
+		procID:  fmt.Sprint(os.Getpid()),
+		appName: header(config.AppName, 48),
+		host:    header(config.Hostname, 255),
+	}, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// dial opens the connection to the syslog daemon
+func dial(config Config) (net.Conn, error) {
+	if config.Network != "" {
+		return net.Dial(config.Network, config.Address)
+	}
+
+	for _, socket := range localSockets {
+		for _, network := range []string{"unixgram", "unix"} {
+			if conn, err := net.Dial(network, socket); err == nil {
+				return conn, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("syslogsink: no local syslog daemon found")
+}
+
+//-----------------------------------------------------------------------------
+
+// Post writes the message to syslog
+func (s *Sink) Post(tag string, t time.Time, message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf("<%d>1 %s %s %s %s %s - %s",
+		s.config.Facility*8+s.config.Severity,
+		t.Format(time.RFC3339Nano),
+		s.host,
+		s.appName,
+		s.procID,
+		header(tag, 32),
+		data,
+	)
+	if s.framed {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.conn.Write([]byte(msg))
+	return err
+}
+
+//-----------------------------------------------------------------------------
+
+// Close closes the connection to the syslog daemon
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn.Close()
+}
+
+//-----------------------------------------------------------------------------
+
+// header makes value a valid RFC 5424 header field: printable US-ASCII
+// without spaces, at most max characters, "-" when empty
+func header(value string, max int) string {
+	value = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, value)
+	if len(value) > max {
+		value = value[:max]
+	}
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,136 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// requestTag returns the tag to be used for the given request: the tag of
+// its RouteOptions, or else the TagFunc or Tag of the configuration
+func (l *Logger) requestTag(c *fiber.Ctx) string {
+	config := l.config()
+	tag := config.Tag
+	if opts := routeOptions(c); opts != nil && opts.Tag != "" {
+		tag = opts.Tag
+		if strings.Contains(tag, "${") {
+			tag = expandTag(c, tag)
+		}
+	} else if config.TagFunc != nil {
+		tag = config.TagFunc(c)
+	} else if strings.Contains(tag, "${") {
+		tag = expandTag(c, tag)
+	}
+	if config.HostAsTag {
+		if host := sanitizeTagPart(c.Hostname()); host != "" {
+			tag += "." + host
+		}
+	}
+	return tag
+}
+
+//-----------------------------------------------------------------------------
+
+// baseTag returns the tag under which the records not tied to the request
+// log (events, audit records, slog records) are posted: Tag without its
+// template components, which need a request, or the default Tag when that
+// leaves nothing, e.g. when only TagFunc is set
+func (l *Logger) baseTag() string {
+	tag := l.config().Tag
+	if strings.Contains(tag, "${") {
+		parts := strings.Split(tag, ".")
+		parts = slices.DeleteFunc(parts, func(part string) bool { return strings.Contains(part, "${") })
+		tag = strings.Join(parts, ".")
+	}
+	if tag == "" {
+		tag = ConfigDefault.Tag
+	}
+	return tag
+}
+
+//-----------------------------------------------------------------------------
+
+// expandTag replaces the placeholders of a tag template such as
+// "app.${method}.${status_class}" with the sanitized request values:
+// ${method}, ${status}, ${status_class}, ${route} and ${host}. Unknown
+// placeholders are left as they are
+func expandTag(c *fiber.Ctx, template string) string {
+	return tagPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		var value string
+		switch placeholder[2 : len(placeholder)-1] {
+		case "method":
+			value = strings.ToLower(c.Method())
+		case "status":
+			value = strconv.Itoa(c.Response().StatusCode())
+		case "status_class":
+			value = statusClass(c.Response().StatusCode())
+		case "route":
+			value = strings.Trim(c.Route().Path, "/")
+		case "host":
+			value = c.Hostname()
+		default:
+			return placeholder
+		}
+		if value = sanitizeTagPart(value); value == "" {
+			value = "_"
+		}
+		return value
+	})
+}
+
+var tagPlaceholder = regexp.MustCompile(`\$\{[a-z_]+\}`)
+
+//-----------------------------------------------------------------------------
+
+// sanitizeTagPart makes s safe to be used as a single tag component. Dots are
+// the fluentd tag separator, so they are replaced along with any character
+// other than letters, digits, '-' and '_'
+func sanitizeTagPart(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
+
+//-----------------------------------------------------------------------------
+
+// responseStatus returns the status code the response will have. When the
+// handler returned an error, the error handler has not set it yet unless
+// LogErrorOnce ran it, so it is guessed the way Fiber's default error
+// handler does
+func responseStatus(c *fiber.Ctx, err error) int {
+	if err == nil || ErrorLogged(c) {
+		return c.Response().StatusCode()
+	}
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return fe.Code
+	}
+	return fiber.StatusInternalServerError
+}
@@ -0,0 +1,73 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"time"
+)
+
+//*****************************************************************************
+
+// The TimestampFormat values for numeric timestamps, as int64
+const (
+	TimestampUnix      = "unix"    // seconds since the epoch
+	TimestampUnixMilli = "unix_ms" // milliseconds since the epoch
+	TimestampUnixMicro = "unix_us" // microseconds since the epoch
+	TimestampUnixNano  = "unix_ns" // nanoseconds since the epoch
+)
+
+//-----------------------------------------------------------------------------
+
+// now returns the current time of Clock
+func (l *Logger) now() time.Time {
+	return l.config().Clock()
+}
+
+//-----------------------------------------------------------------------------
+
+// timestamp formats t as TimestampFormat tells: one of the Timestamp
+// constants, or else a time layout applied in UTC
+func (l *Logger) timestamp(t time.Time) interface{} {
+	switch format := l.config().TimestampFormat; format {
+	case TimestampUnix:
+		return t.Unix()
+	case TimestampUnixMilli:
+		return t.UnixMilli()
+	case TimestampUnixMicro:
+		return t.UnixMicro()
+	case TimestampUnixNano:
+		return t.UnixNano()
+	case "":
+		return t.UTC().Format(time.RFC3339Nano)
+	default:
+		return t.UTC().Format(format)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// addTimestamp adds the TimestampField of a record with event time t,
+// unless the record already has it
+func (l *Logger) addTimestamp(record map[string]interface{}, t time.Time) {
+	field := l.config().TimestampField
+	if field == "" {
+		return
+	}
+	if _, ok := record[field]; !ok {
+		record[field] = l.timestamp(t)
+	}
+}
@@ -0,0 +1,57 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"crypto/tls"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// addClientCertFields adds the subject and serial of the verified client
+// certificate; nothing is added for plain or non-mTLS connections
+func addClientCertFields(c *fiber.Ctx, record map[string]interface{}) {
+	state := c.Context().TLSConnectionState()
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return
+	}
+
+	cert := state.PeerCertificates[0]
+	record["client_cert_subject"] = cert.Subject.String()
+	record["client_cert_serial"] = cert.SerialNumber.String()
+}
+
+//-----------------------------------------------------------------------------
+
+// addTLSFields adds the version, cipher suite and SNI server name of the TLS
+// connection, and whether the client presented a certificate; nothing is
+// added for plain connections
+func addTLSFields(c *fiber.Ctx, record map[string]interface{}) {
+	state := c.Context().TLSConnectionState()
+	if state == nil {
+		return
+	}
+
+	record["tls_version"] = tls.VersionName(state.Version)
+	record["tls_cipher_suite"] = tls.CipherSuiteName(state.CipherSuite)
+	if state.ServerName != "" {
+		record["tls_server_name"] = state.ServerName
+	}
+	record["tls_client_cert"] = len(state.PeerCertificates) > 0
+}
@@ -0,0 +1,103 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/hex"
+	"strings"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+//*****************************************************************************
+
+// HeaderTraceparent is the W3C trace context header
+const HeaderTraceparent = "traceparent"
+
+//-----------------------------------------------------------------------------
+
+// traceContext holds the fields of a traceparent header
+type traceContext struct {
+	traceID string
+	spanID  string
+	flags   byte
+}
+
+func (tc traceContext) sampled() bool {
+	return tc.flags&0x01 == 0x01
+}
+
+//-----------------------------------------------------------------------------
+
+// parseTraceparent parses a "version-traceid-parentid-flags" header value
+func parseTraceparent(value string) (traceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return traceContext{}, false
+	}
+	if !validTraceHex(parts[1], 32) || !validTraceHex(parts[2], 16) || len(parts[3]) != 2 {
+		return traceContext{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return traceContext{}, false
+	}
+	return traceContext{
+		traceID: strings.Clone(parts[1]),
+		spanID:  strings.Clone(parts[2]),
+		flags:   flags[0],
+	}, true
+}
+
+//-----------------------------------------------------------------------------
+
+// validTraceHex tells whether s is a lowercase hex ID of the given length
+// which is not all zeros, as required by the W3C spec
+func validTraceHex(s string, length int) bool {
+	if len(s) != length || strings.Trim(s, "0") == "" {
+		return false
+	}
+	for _, r := range s {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+//-----------------------------------------------------------------------------
+
+// addTraceFields adds the trace and span IDs of the request, if any
+func (l *Logger) addTraceFields(c *fiber.Ctx, record map[string]interface{}) {
+	config := l.config()
+	var traceID, spanID string
+	if config.TraceExtractor != nil {
+		traceID, spanID = config.TraceExtractor(c)
+	}
+	if traceID == "" {
+		if tc, ok := parseTraceparent(c.Get(HeaderTraceparent)); ok {
+			traceID, spanID = tc.traceID, tc.spanID
+		}
+	}
+
+	if traceID != "" {
+		record["trace_id"] = traceID
+	}
+	if spanID != "" {
+		record["span_id"] = spanID
+	}
+}
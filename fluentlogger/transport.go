@@ -0,0 +1,278 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/fluent/fluent-logger-golang/fluent"
+	"github.com/google/uuid"
+	"github.com/tinylib/msgp/msgp"
+)
+
+//*****************************************************************************
+
+// the dial timeout used when FluentConfig.Timeout is not set, as the client
+const defaultDialTimeout = 3 * time.Second
+
+//-----------------------------------------------------------------------------
+
+// TLSConfig secures the connections to Fluentd (in_forward with its
+// transport tls section, or Fluent Bit with tls on)
+type TLSConfig struct {
+	CAFile             string // PEM bundle verifying the server, the system pool when empty
+	CertFile           string // PEM client certificate, for mutual TLS
+	KeyFile            string // PEM key of CertFile
+	ServerName         string // the name to verify, the endpoint host when empty
+	InsecureSkipVerify bool   // whether to accept any server certificate
+}
+
+//-----------------------------------------------------------------------------
+
+// build loads the files of the configuration into a tls.Config
+func (t *TLSConfig) build() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading the fluentd CA bundle: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", t.CAFile)
+		}
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading the fluentd client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// tlsEndpoint returns an endpoint posting through its own TLS connection,
+// since the Fluentd client cannot verify the server nor present a
+// certificate. The connection is dialed right away; like the synchronous
+// client, the endpoint is returned along with the error when that fails
+func tlsEndpoint(config fluent.Config, tlsConfig *tls.Config) (*endpoint, error) {
+	config.FluentNetwork = "tls"
+	if config.FluentHost == "" {
+		config.FluentHost = "127.0.0.1"
+	}
+	if config.FluentPort == 0 {
+		config.FluentPort = 24224
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultDialTimeout
+	}
+
+	e := &endpoint{config: config, tls: tlsConfig, owned: true}
+	conn, err := dialConn(config, tlsConfig)
+	if err != nil {
+		return e, err
+	}
+	e.conn = conn
+	return e, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// writeMessage encodes and writes a Message mode message on the own
+// connection of the endpoint, see write
+func (e *endpoint) writeMessage(ctx context.Context, tag string, t time.Time, message interface{}, ackTimeout time.Duration) error {
+	config := e.fluentConfig()
+	if config.TagPrefix != "" {
+		tag = config.TagPrefix + "." + tag
+	}
+	var chunk string
+	if config.RequestAck {
+		chunk = uuid.NewString()
+	}
+	var data []byte
+	var err error
+	if config.MarshalAsJSON {
+		data, err = encodeJSON(chunk, tag, t.Unix(), message)
+	} else {
+		data, err = encodeMessage(tag, t, message, config.SubSecondPrecision, chunk)
+	}
+	if err != nil {
+		return err
+	}
+	return e.write(ctx, data, chunk, ackTimeout)
+}
+
+//-----------------------------------------------------------------------------
+
+// write sends encoded data on the own connection of the endpoint, dialing
+// it if needed, and waits up to ackTimeout for the acknowledgement of chunk
+// when it is not empty. Neither the write nor the wait outlast the deadline
+// of ctx. The connection is dropped on errors, to be dialed again by the
+// next write
+func (e *endpoint) write(ctx context.Context, data []byte, chunk string, ackTimeout time.Duration) (err error) {
+	config := e.fluentConfig()
+
+	e.connMu.Lock()
+	defer e.connMu.Unlock()
+	if e.conn == nil {
+		if e.conn, err = dialConn(config, e.tls); err != nil {
+			e.conn = nil
+			return err
+		}
+	}
+	defer func() {
+		if err != nil {
+			e.conn.Close()
+			e.conn = nil
+		}
+	}()
+
+	if deadline, ok := writeDeadline(ctx, config.WriteTimeout); ok {
+		e.conn.SetWriteDeadline(deadline)
+	}
+	if _, err = e.conn.Write(data); err != nil || chunk == "" {
+		return err
+	}
+
+	if ackTimeout <= 0 {
+		ackTimeout = defaultAckTimeout
+	}
+	deadline, _ := writeDeadline(ctx, ackTimeout)
+	e.conn.SetReadDeadline(deadline)
+	var resp fluent.AckResp
+	if err = resp.DecodeMsg(msgp.NewReader(e.conn)); err == nil && resp.Ack != chunk {
+		err = fmt.Errorf("message acknowledged as %q instead of %q", resp.Ack, chunk)
+	}
+	return err
+}
+
+//-----------------------------------------------------------------------------
+
+// writeDeadline returns the earliest of the deadline of ctx and timeout from
+// now, a zero timeout meaning none
+func writeDeadline(ctx context.Context, timeout time.Duration) (time.Time, bool) {
+	deadline, ok := ctx.Deadline()
+	if timeout > 0 {
+		if d := time.Now().Add(timeout); !ok || d.Before(deadline) {
+			return d, true
+		}
+	}
+	return deadline, ok
+}
+
+//-----------------------------------------------------------------------------
+
+// closeConn closes the own connection of the endpoint, if any
+func (e *endpoint) closeConn() {
+	e.connMu.Lock()
+	defer e.connMu.Unlock()
+	if e.conn != nil {
+		e.conn.Close()
+		e.conn = nil
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// dialConn connects to the Fluentd server of a client configuration, the
+// way the client itself does unless tlsConfig is set
+func dialConn(config fluent.Config, tlsConfig *tls.Config) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: config.Timeout}
+	address := net.JoinHostPort(config.FluentHost, strconv.Itoa(config.FluentPort))
+	switch config.FluentNetwork {
+	case "tcp":
+		return dialer.Dial("tcp", address)
+	case "tls":
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{InsecureSkipVerify: config.TlsInsecureSkipVerify}
+		}
+		return tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	case "unix":
+		return dialer.Dial("unix", config.FluentSocketPath)
+	default:
+		return nil, fluent.NewErrUnknownNetwork(config.FluentNetwork)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// encodeMessage encodes [tag, time, record, option], the Message mode of the
+// Fluentd forward protocol. The option requests an acknowledgement when
+// chunk is not empty
+func encodeMessage(tag string, t time.Time, message interface{}, subSecond bool, chunk string) ([]byte, error) {
+	fields := uint32(3)
+	if chunk != "" {
+		fields = 4
+	}
+	b := msgp.AppendArrayHeader(nil, fields)
+	b = msgp.AppendString(b, tag)
+
+	b, err := appendEventTime(b, t, subSecond)
+	if err != nil {
+		return nil, err
+	}
+	if b, err = msgp.AppendIntf(b, message); err != nil {
+		return nil, err
+	}
+	if chunk != "" {
+		b = msgp.AppendMapHeader(b, 1)
+		b = msgp.AppendString(b, "chunk")
+		b = msgp.AppendString(b, chunk)
+	}
+	return b, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// encodeJSON encodes the fields of a message as a JSON array, the way the
+// client does with MarshalAsJSON, adding the option requesting an
+// acknowledgement when chunk is not empty
+func encodeJSON(chunk string, fields ...interface{}) ([]byte, error) {
+	if chunk != "" {
+		fields = append(fields, map[string]string{"chunk": chunk})
+	}
+	return json.Marshal(fields)
+}
+
+//-----------------------------------------------------------------------------
+
+// appendEventTime appends an event time, as an EventTime extension with
+// subSecond and as unix seconds otherwise
+func appendEventTime(b []byte, t time.Time, subSecond bool) ([]byte, error) {
+	if !subSecond {
+		return msgp.AppendInt64(b, t.Unix()), nil
+	}
+	et := fluent.EventTime(t)
+	return msgp.AppendExtension(b, &et)
+}
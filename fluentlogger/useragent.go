@@ -0,0 +1,120 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"strings"
+)
+
+//*****************************************************************************
+
+// markers of the automated clients, matched against the lowercased UA
+var botMarkers = []string{
+	"bot", "crawler", "spider", "slurp", "curl/", "wget/", "python-requests",
+	"go-http-client", "okhttp", "headlesschrome", "lighthouse",
+}
+
+// browsers in matching order: the UA of most browsers also names the ones
+// they derive from (e.g. Edge says Chrome and Safari)
+var browsers = []struct{ name, token string }{
+	{"Edge", "Edg/"},
+	{"Opera", "OPR/"},
+	{"Samsung Internet", "SamsungBrowser/"},
+	{"Firefox", "Firefox/"},
+	{"Firefox", "FxiOS/"},
+	{"Chrome", "CriOS/"},
+	{"Chrome", "Chrome/"},
+	{"Safari", "Version/"},
+	{"Internet Explorer", "MSIE "},
+}
+
+// operating systems in matching order, e.g. Android UAs also say Linux
+var systems = []struct{ name, token string }{
+	{"Windows", "Windows"},
+	{"iOS", "iPhone"},
+	{"iOS", "iPad"},
+	{"iOS", "iPod"},
+	{"Android", "Android"},
+	{"ChromeOS", "CrOS"},
+	{"macOS", "Mac OS X"},
+	{"Linux", "Linux"},
+}
+
+//-----------------------------------------------------------------------------
+
+// ParseUserAgent is a lightweight UserAgentParser which recognizes the
+// common browsers and systems. It returns "browser", "browser_version",
+// "os", "device" ("desktop", "mobile", "tablet" or "bot") and "is_bot";
+// unknown parts are omitted
+func ParseUserAgent(ua string) map[string]interface{} {
+	if ua == "" {
+		return nil
+	}
+
+	lower := strings.ToLower(ua)
+	bot := false
+	for _, marker := range botMarkers {
+		if strings.Contains(lower, marker) {
+			bot = true
+			break
+		}
+	}
+
+	parsed := map[string]interface{}{"is_bot": bot}
+	for _, b := range browsers {
+		if i := strings.Index(ua, b.token); i >= 0 {
+			parsed["browser"] = b.name
+			if version := uaVersion(ua[i+len(b.token):]); version != "" {
+				parsed["browser_version"] = version
+			}
+			break
+		}
+	}
+	if _, ok := parsed["browser"]; !ok && strings.Contains(ua, "Trident/") {
+		parsed["browser"] = "Internet Explorer"
+	}
+	for _, s := range systems {
+		if strings.Contains(ua, s.token) {
+			parsed["os"] = s.name
+			break
+		}
+	}
+
+	switch {
+	case bot:
+		parsed["device"] = "bot"
+	case strings.Contains(ua, "iPad") || strings.Contains(ua, "Tablet") ||
+		(strings.Contains(ua, "Android") && !strings.Contains(ua, "Mobile")):
+		parsed["device"] = "tablet"
+	case strings.Contains(ua, "Mobi") || strings.Contains(ua, "iPhone"):
+		parsed["device"] = "mobile"
+	default:
+		parsed["device"] = "desktop"
+	}
+	return parsed
+}
+
+//-----------------------------------------------------------------------------
+
+// uaVersion returns the version at the start of s, up to the first space,
+// semicolon or parenthesis
+func uaVersion(s string) string {
+	if i := strings.IndexAny(s, " ;()"); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
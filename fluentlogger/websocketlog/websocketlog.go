@@ -0,0 +1,161 @@
+// Package websocketlog logs the lifecycle of the WebSocket connections
+// served with github.com/gofiber/contrib/websocket: an event when a
+// connection opens and one when it closes, with its duration, close code and
+// the bytes and messages transferred. It is a module of its own, so the
+// middleware itself does not depend on the WebSocket packages.
+package websocketlog
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"maps"
+	"sync/atomic"
+	"time"
+
+	fasthttpws "github.com/fasthttp/websocket"
+	"github.com/gofiber/contrib/websocket"
+	fiber "github.com/gofiber/fiber/v2"
+	fiberfluentdlogger "github.com/rgglez/gofiber-fluent-middleware/fluentlogger"
+)
+
+//*****************************************************************************
+
+// the c.Locals key carrying the request fields to the connection
+const fieldsLocal = "fluentlogger.websocket_fields"
+
+//-----------------------------------------------------------------------------
+
+// Conn is a WebSocket connection counting what goes through ReadMessage,
+// WriteMessage, ReadJSON and WriteJSON; the readers and writers of the
+// underlying connection are not counted
+type Conn struct {
+	*websocket.Conn
+
+	bytesRead, bytesWritten       atomic.Int64
+	messagesRead, messagesWritten atomic.Int64
+	closeCode                     atomic.Int64
+	closeErr                      atomic.Pointer[string]
+}
+
+//-----------------------------------------------------------------------------
+
+// ReadMessage reads a message, counting it. The close code of the peer is
+// kept for the closing event
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	messageType, data, err := c.Conn.ReadMessage()
+	if err != nil {
+		var ce *fasthttpws.CloseError
+		if errors.As(err, &ce) {
+			c.closeCode.CompareAndSwap(0, int64(ce.Code))
+		} else {
+			msg := err.Error()
+			c.closeErr.CompareAndSwap(nil, &msg)
+		}
+		return messageType, data, err
+	}
+	c.bytesRead.Add(int64(len(data)))
+	c.messagesRead.Add(1)
+	return messageType, data, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// WriteMessage writes a message, counting it. The code of a close message
+// is kept for the closing event
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	if err := c.Conn.WriteMessage(messageType, data); err != nil {
+		return err
+	}
+	if messageType == websocket.CloseMessage && len(data) >= 2 {
+		c.closeCode.CompareAndSwap(0, int64(binary.BigEndian.Uint16(data)))
+	}
+	c.bytesWritten.Add(int64(len(data)))
+	c.messagesWritten.Add(1)
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// ReadJSON reads a message and decodes it as JSON into v
+func (c *Conn) ReadJSON(v interface{}) error {
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+//-----------------------------------------------------------------------------
+
+// WriteJSON writes v as a JSON text message
+func (c *Conn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(websocket.TextMessage, data)
+}
+
+//-----------------------------------------------------------------------------
+
+// New returns a handler upgrading the requests to WebSocket connections
+// served by handler, like websocket.New, and posting the events
+// "<tag>.websocket.opened" and "<tag>.websocket.closed" through l. Both
+// carry the request fields (see Logger.RequestFields); the closing one adds
+// "duration_ms", "close_code" (when known), "close_error", "bytes_read",
+// "bytes_written", "messages_read" and "messages_written". Requests which
+// are not upgrades get fiber.ErrUpgradeRequired
+func New(l *fiberfluentdlogger.Logger, handler func(*Conn), config ...websocket.Config) fiber.Handler {
+	upgrade := websocket.New(func(ws *websocket.Conn) {
+		fields, _ := ws.Locals(fieldsLocal).(map[string]interface{})
+		conn := &Conn{Conn: ws}
+		start := time.Now()
+		l.Event("websocket.opened", fields)
+
+		defer func() {
+			closed := maps.Clone(fields)
+			if closed == nil {
+				closed = make(map[string]interface{})
+			}
+			closed["duration_ms"] = time.Since(start).Milliseconds()
+			if code := conn.closeCode.Load(); code != 0 {
+				closed["close_code"] = code
+			}
+			if msg := conn.closeErr.Load(); msg != nil {
+				closed["close_error"] = *msg
+			}
+			closed["bytes_read"] = conn.bytesRead.Load()
+			closed["bytes_written"] = conn.bytesWritten.Load()
+			closed["messages_read"] = conn.messagesRead.Load()
+			closed["messages_written"] = conn.messagesWritten.Load()
+			l.Event("websocket.closed", closed)
+		}()
+
+		handler(conn)
+	}, config...)
+
+	return func(c *fiber.Ctx) error {
+		if !websocket.IsWebSocketUpgrade(c) {
+			return fiber.ErrUpgradeRequired
+		}
+		c.Locals(fieldsLocal, l.RequestFields(c))
+		return upgrade(c)
+	}
+}
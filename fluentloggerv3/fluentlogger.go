@@ -0,0 +1,271 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/fluent/fluent-logger-golang/fluent"
+	"github.com/gofiber/fiber/v3"
+	"github.com/ztrue/tracerr"
+)
+
+//*****************************************************************************
+
+type LoggerConfig struct {
+	// Next defines a function to skip the middleware when it returns true
+	Next func(c fiber.Ctx) bool
+
+	// SkipPaths and SkipMethods skip the middleware for the matching
+	// requests, in addition to Next. Paths are glob patterns (see matchPath)
+	SkipPaths   []string
+	SkipMethods []string
+
+	Enabled bool   // whether the middleware is enabled
+	Host    string // the fluentd server address
+	Port    int    // the fluentd server port
+	Tag     string // the tag to be used for the messages
+
+	// TagFunc, when set, returns the tag of each request instead of Tag
+	TagFunc func(c fiber.Ctx) string
+
+	// FluentConfig is passed to fluent.New, so every option of the client
+	// (Timeout, BufferLimit, Async, MaxRetry...) can be set. Host and Port,
+	// when set, take precedence over FluentHost and FluentPort
+	FluentConfig fluent.Config
+
+	// RequestHeaders lists the request headers logged under
+	// "request_headers"
+	RequestHeaders []string
+
+	// PanicRecover makes PanicLogger turn panics into the response built by
+	// PanicHandler (a 500 fiber.Error by default) instead of panicking again
+	// after logging them
+	PanicRecover bool
+	PanicHandler func(c fiber.Ctx, recovered interface{}) error
+}
+
+// ConfigDefault posts the access records tagged "fiber.access" to the
+// Fluentd of the local host on the standard forward port
+var ConfigDefault = LoggerConfig{
+	Enabled: true,
+	Host:    "127.0.0.1",
+	Port:    24224,
+	Tag:     "fiber.access",
+}
+
+// ErrInvalidConfig is wrapped by the errors describing the problems of a
+// configuration rejected by New
+var ErrInvalidConfig = errors.New("invalid logger config")
+
+type Logger struct {
+	client *fluent.Fluent
+	owned  bool // whether Close closes the client
+	tag    string
+	config LoggerConfig
+}
+
+//-----------------------------------------------------------------------------
+
+// DefaultConfig returns a copy of ConfigDefault, to be adjusted before being
+// given to New
+func DefaultConfig() LoggerConfig {
+	return ConfigDefault
+}
+
+//-----------------------------------------------------------------------------
+
+// New initializes a Fluentd logger and returns a middleware, or a no-op one
+// (its handler only calls c.Next()) when config is not Enabled. Start from
+// DefaultConfig: the zero Host, Port and Tag are rejected, with an error
+// wrapping ErrInvalidConfig
+func New(config LoggerConfig) (*Logger, error) {
+	if !config.Enabled {
+		return &Logger{config: config}, nil
+	}
+	if err := validate(config); err != nil {
+		return nil, err
+	}
+
+	// Initialize Fluentd logger
+	fluentConfig := config.FluentConfig
+	if config.Host != "" {
+		fluentConfig.FluentHost = config.Host
+	}
+	if config.Port != 0 {
+		fluentConfig.FluentPort = config.Port
+	}
+	fluentLogger, err := fluent.New(fluentConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	l := NewWithClient(fluentLogger, config)
+	l.owned = true
+	return l, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// NewWithClient returns a middleware posting through an existing Fluentd
+// client, which is left open by Close
+func NewWithClient(client *fluent.Fluent, config LoggerConfig) *Logger {
+	return &Logger{
+		client: client,
+		tag:    config.Tag,
+		config: config,
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// validate returns the problems of config, joined, or nil
+func validate(config LoggerConfig) error {
+	var errs []error
+	host, port := config.FluentConfig.FluentHost, config.FluentConfig.FluentPort
+	if config.Host != "" {
+		host = config.Host
+	}
+	if config.Port != 0 {
+		port = config.Port
+	}
+	unix := config.FluentConfig.FluentNetwork == "unix" && config.FluentConfig.FluentSocketPath != ""
+
+	if config.Tag == "" && config.TagFunc == nil {
+		errs = append(errs, fmt.Errorf("%w: empty Tag", ErrInvalidConfig))
+	}
+	if host == "" && !unix {
+		errs = append(errs, fmt.Errorf("%w: missing Host", ErrInvalidConfig))
+	}
+	if (port < 1 || port > 65535) && !unix {
+		errs = append(errs, fmt.Errorf("%w: Port %d out of the 1-65535 range", ErrInvalidConfig, port))
+	}
+	return errors.Join(errs...)
+}
+
+//-----------------------------------------------------------------------------
+
+// Logger logs each request to Fluentd
+func (l *Logger) Logger() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if l.client == nil || l.skip(c) {
+			return c.Next()
+		}
+
+		start := time.Now()
+		err := c.Next() // Process the request
+		latency := time.Since(start)
+
+		// Log data to Fluentd
+		logData := map[string]interface{}{
+			"method":        c.Method(),
+			"path":          c.Path(),
+			"status":        c.Response().StatusCode(),
+			"latency_ms":    latency.Milliseconds(),
+			"client_ip":     c.IP(),
+			"user_agent":    c.Get("User-Agent"),
+			"response_size": len(c.Response().Body()),
+		}
+		if len(l.config.RequestHeaders) > 0 {
+			headers := make(map[string]string, len(l.config.RequestHeaders))
+			for _, name := range l.config.RequestHeaders {
+				if value := c.Get(name); value != "" {
+					headers[name] = value
+				}
+			}
+			logData["request_headers"] = headers
+		}
+		if err != nil {
+			logData["error"] = tracerr.SprintSource(err)
+		}
+
+		// Send to Fluentd, timestamped with the start of the request. The
+		// strings of the context are copied since they are reused once the
+		// handler returns, and the client may keep the record (Async)
+		for name, value := range logData {
+			if s, ok := value.(string); ok {
+				logData[name] = strings.Clone(s)
+			}
+		}
+		if perr := l.client.PostWithTime(l.requestTag(c), start, logData); perr != nil {
+			tracerr.PrintSource(perr)
+		}
+
+		return err
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// Close closes the Fluentd client, when it was opened by New
+func (l *Logger) Close() error {
+	if !l.owned {
+		return nil
+	}
+	return l.client.Close()
+}
+
+//-----------------------------------------------------------------------------
+
+// requestTag returns the tag of the access record of a request
+func (l *Logger) requestTag(c fiber.Ctx) string {
+	if l.config.TagFunc != nil {
+		return l.config.TagFunc(c)
+	}
+	return l.tag
+}
+
+//-----------------------------------------------------------------------------
+
+// skip tells whether a request must not be logged
+func (l *Logger) skip(c fiber.Ctx) bool {
+	if l.config.Next != nil && l.config.Next(c) {
+		return true
+	}
+
+	for _, method := range l.config.SkipMethods {
+		if strings.EqualFold(c.Method(), method) {
+			return true
+		}
+	}
+
+	p := c.Path()
+	for _, pattern := range l.config.SkipPaths {
+		if matchPath(pattern, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//-----------------------------------------------------------------------------
+
+// matchPath matches p against a path.Match pattern, e.g. "/healthz" or
+// "/api/*/status". A trailing "/**" matches the prefix and everything below
+// it, e.g. "/static/**"
+func matchPath(pattern, p string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return p == prefix || strings.HasPrefix(p, prefix+"/")
+	}
+	matched, _ := path.Match(pattern, p)
+	return matched
+}
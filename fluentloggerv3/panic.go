@@ -0,0 +1,95 @@
+package fiberfluentdlogger
+
+/*
+Copyright 2024 Rodolfo González González
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/ztrue/tracerr"
+)
+
+//*****************************************************************************
+
+// PanicLogger recovers the panics of the next handlers and logs them to
+// Fluentd, tagged "<tag>.panic", with the panic value, its type and the
+// stack trace of the panicking goroutine. The panic is then raised again for
+// an outer recover middleware, unless PanicRecover is set
+func (l *Logger) PanicLogger() fiber.Handler {
+	return func(c fiber.Ctx) (err error) {
+		if l.client == nil || l.skip(c) {
+			return c.Next()
+		}
+
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+
+			l.logPanic(c, recovered)
+
+			if !l.config.PanicRecover {
+				panic(recovered)
+			}
+			if l.config.PanicHandler != nil {
+				err = l.config.PanicHandler(c, recovered)
+			} else {
+				err = fiber.ErrInternalServerError
+			}
+		}()
+
+		return c.Next() // Process the request
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// logPanic sends the record of a recovered panic. It must be called from the
+// deferred function, so the panicking frames are still on the stack
+func (l *Logger) logPanic(c fiber.Ctx, recovered interface{}) {
+	logData := map[string]interface{}{
+		"method":     strings.Clone(c.Method()),
+		"path":       strings.Clone(c.Path()),
+		"client_ip":  strings.Clone(c.IP()),
+		"user_agent": strings.Clone(c.Get("User-Agent")),
+		"error":      fmt.Sprint(recovered),
+		"panic":      true,
+		"panic_type": fmt.Sprintf("%T", recovered),
+		"stacktrace": panicStack(),
+	}
+
+	if err := l.client.PostWithTime(l.requestTag(c)+".panic", time.Now(), logData); err != nil {
+		tracerr.PrintSource(err)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// panicStack returns the stack trace of the panicking goroutine from the
+// frame which panicked, without the frames of the recovery itself
+func panicStack() string {
+	stack := string(debug.Stack())
+	header, frames, _ := strings.Cut(stack, "\n")
+	if i := strings.Index(frames, "\npanic("); i >= 0 {
+		frames = frames[i+1:]
+	}
+	return header + "\n" + frames
+}